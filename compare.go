@@ -1,208 +1,173 @@
 package main
 
 import (
-	"fmt"
-	"math"
 	"os"
-	"sort"
+	"path/filepath"
 	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"github.com/stackrox/prometheus-metric-parser/pkg/metrics"
 )
 
-type changeThresholds struct {
-	warnAt  float64
-	errorAt float64
-}
-
 func compareCommand() *cobra.Command {
 	var (
-		oldFile string
-		newFile string
-		warnAt  float64
-		errorAt float64
-
-		opts *metricOptions
+		oldFiles      []string
+		newFile       string
+		failOnAdded   bool
+		failOnRemoved bool
+		rulesFile     string
+		directionFlag string
+		outsideRange  string
+		distTest      string
+		defaults      metrics.Rule
+		junitOut      string
+
+		opts      *metricOptions
+		inputOpts *metrics.InputOptions
 	)
 
 	c := &cobra.Command{
 		Use:   "compare",
 		Short: "Compare takes two metrics files and compares them takes all the metrics and outputs them as key value pairs. It will average histograms",
 		RunE: func(c *cobra.Command, _ []string) error {
-			if oldFile == "" {
+			if len(oldFiles) == 0 {
 				return errors.New("old-file must be specified")
 			}
 			if newFile == "" {
 				return errors.New("new-file must be specified")
 			}
-			oldFamilies, err := readFile(oldFile)
+			oldFiles, err := expandGlobs(oldFiles)
 			if err != nil {
-				return errors.Wrap(err, "error reading old file")
+				return err
 			}
-
-			oldMetricMap, err := familiesToKeyPairs(oldFamilies, opts)
+			stdinFiles := 0
+			for _, file := range append(oldFiles, newFile) {
+				if file == metrics.StdinPath {
+					stdinFiles++
+				}
+			}
+			if stdinFiles > 1 {
+				return errors.New("only one of old-file and new-file can be read from stdin")
+			}
+			var rules []*metrics.Rule
+			if rulesFile != "" {
+				var err error
+				if rules, err = metrics.LoadRules(rulesFile); err != nil {
+					return err
+				}
+			}
+			defaults.Direction = metrics.Direction(directionFlag)
+			defaults.OutsideRange = metrics.Status(outsideRange)
+			defaults.DistributionTest = metrics.DistributionTest(distTest)
+			thresholds, err := metrics.NewThresholds(defaults, rules)
 			if err != nil {
-				return errors.Wrap(err, "error generating old metric map")
+				return err
+			}
+
+			var oldRuns []metrics.Map
+			for _, oldFile := range oldFiles {
+				oldFamilies, err := readFile(oldFile, inputOpts)
+				if err != nil {
+					return errors.Wrapf(err, "error reading old file %s", oldFile)
+				}
+
+				oldMetricMap, err := opts.toSeries(oldFamilies)
+				if err != nil {
+					return errors.Wrapf(err, "error generating old metric map of %s", oldFile)
+				}
+				oldRuns = append(oldRuns, oldMetricMap)
 			}
 
-			newFamilies, err := readFile(newFile)
+			newFamilies, err := readFile(newFile, inputOpts)
 			if err != nil {
 				return errors.Wrap(err, "error reading new file")
 			}
 
-			newMetricMap, err := familiesToKeyPairs(newFamilies, opts)
+			newMetricMap, err := opts.toSeries(newFamilies)
 			if err != nil {
 				return errors.Wrap(err, "error generating new metric map")
 			}
 
-			compareMetricMaps(oldMetricMap, newMetricMap, changeThresholds{warnAt, errorAt}, opts)
+			comparison := metrics.Compare(metrics.MergeBaselines(oldRuns), newMetricMap, metrics.CompareOptions{
+				Thresholds:    thresholds,
+				FailOnAdded:   failOnAdded,
+				FailOnRemoved: failOnRemoved,
+			})
+			if err := metrics.WriteComparison(os.Stdout, opts.format, comparison); err != nil {
+				return err
+			}
+			if junitOut != "" {
+				if err := writeJUnitFile(junitOut, comparison); err != nil {
+					return err
+				}
+			}
+			if comparison.Failed() {
+				return errors.New("comparison failed")
+			}
 			return nil
 		},
 	}
 
-	c.Flags().StringVar(&oldFile, "old-file", "", "old metrics file to parse")
-	c.Flags().StringVar(&newFile, "new-file", "", "new metrics file to parse")
-	c.Flags().Float64Var(&warnAt, "warn", 0, "warn when values change more or less than this percentage amount")
-	c.Flags().Float64Var(&errorAt, "error", 0, "error when values change more or less than this percentage amount and exit 1")
+	c.Flags().StringArrayVar(&oldFiles, "old-file", nil, "old metrics file to parse, - for stdin or an http(s) URL to scrape; repeat or use a glob to compare against multiple baseline runs")
+	c.Flags().StringVar(&newFile, "new-file", "", "new metrics file to parse, - for stdin or an http(s) URL to scrape")
+	c.Flags().Float64Var(&defaults.Warn, "warn", 0, "warn when values change more or less than this percentage amount")
+	c.Flags().Float64Var(&defaults.Error, "error", 0, "error when values change more or less than this percentage amount and exit 1")
+	c.Flags().StringVar(&directionFlag, "direction", string(metrics.DirectionAuto), "which changes are regressions for --warn and --error (options are auto, both, higher-is-worse or lower-is-worse)")
+	c.Flags().Float64Var(&defaults.MinAbsDelta, "min-abs-delta", 0, "only warn or error when the absolute change is at least this amount")
+	c.Flags().Float64Var(&defaults.MinValue, "min-value", 0, "only warn or error when the absolute old value is at least this amount")
+	c.Flags().Float64Var(&defaults.MinCount, "min-compare-count", 0, "report histograms and summaries with fewer observations than this as insufficient data")
+	c.Flags().Float64Var(&defaults.WarnZ, "warn-z", 0, "warn when values are more than this many standard deviations away from the mean of multiple baseline runs")
+	c.Flags().Float64Var(&defaults.ErrorZ, "error-z", 0, "error when values are more than this many standard deviations away from the mean of multiple baseline runs and exit 1")
+	c.Flags().StringVar(&outsideRange, "outside-range", "", "warn or error when values are outside the range of multiple baseline runs (options are warn or error)")
+	c.Flags().StringVar(&distTest, "distribution-test", "", "compare the bucket distributions of histograms (options are ks or chi2)")
+	c.Flags().Float64Var(&defaults.WarnP, "warn-p", 0, "warn when the p-value of the distribution test is below this significance level")
+	c.Flags().Float64Var(&defaults.ErrorP, "error-p", 0, "error when the p-value of the distribution test is below this significance level and exit 1")
+	c.Flags().StringVar(&rulesFile, "thresholds", "", "yaml file with per metric warn and error thresholds overriding --warn and --error")
+	c.Flags().BoolVar(&failOnAdded, "fail-on-added", false, "exit 1 when series are only present in the new file")
+	c.Flags().BoolVar(&failOnRemoved, "fail-on-removed", false, "exit 1 when series are only present in the old file")
+	c.Flags().StringVar(&junitOut, "junit-out", "", "additionally write the comparison as JUnit XML to this file")
 
 	opts = addMetricFlags(c)
-
-	return c
-}
-
-func stdoutPrint(keys []familyKey, oldMap, newMap metricMap, deltas oldNewDeltaMap) {
-	// Show comparisons
-	for _, k := range keys {
-		delta := deltas[k]
-		if oldMap[k].value != 0 {
-			prefixParts := make([]string, 0)
-			if delta.isWarn || delta.isError {
-				prefixParts = append(prefixParts, "1")
-			}
-			if delta.isError {
-				prefixParts = append(prefixParts, "31", "4")
-			}
-			decorationPrefix := ""
-			if len(prefixParts) > 0 {
-				decorationPrefix = "\033[" + strings.Join(prefixParts, ";") + "m"
-			}
-			decorationSuffix := ""
-			if decorationPrefix != "" {
-				decorationSuffix = "\033[0m"
-			}
-			fmt.Printf("%s%s %s (old: %s, new %s): change: %0.4f%%%s\n",
-				decorationPrefix, k.metric, k.labels, oldMap[k].String(), newMap[k].String(), delta.percentChange, decorationSuffix)
-		} else {
-			fmt.Printf("%s %s (old: %s, new %s)\n", k.metric, k.labels, oldMap[k].String(), newMap[k].String())
-		}
+	inputOpts = addInputFlags(c)
+	// The ingest flags have always been accepted by compare, so they are kept for existing calls.
+	for _, name := range []string{"labels", "project-id", "timestamp"} {
+		_ = c.Flags().MarkDeprecated(name, "it has no effect on compare")
 	}
-}
 
-func csvPrint(keys []familyKey, oldMap, newMap metricMap, deltas oldNewDeltaMap) {
-	for _, k := range keys {
-		newMetric := newMap[k]
-		oldMetric := oldMap[k]
-		delta := deltas[k]
-		if oldMetric.value != 0 {
-			fmt.Printf("%s,%s,%g,%g,%g\n", k.metric, k.labels, oldMetric.value, newMetric.value, delta.percentChange)
-			//fmt.Printf("%s %s (old: %s, new %s): change: %0.4f%%\n", k.metric, k.labels, oldMap[k].String(), newMap[k].String(), percentChange)
-		} else {
-			fmt.Printf("%s,%s,%g,%g,N/A\n", k.metric, k.labels, oldMetric.value, newMetric.value)
-		}
-	}
+	return c
 }
 
-func htmlTablePrint(keys []familyKey, oldMap, newMap metricMap, deltas oldNewDeltaMap) {
-	fmt.Printf("<table>\n")
-	fmt.Printf("<thead><th>Metric</th><th>Labels</th><th>Baseline Value</th><th>New Value</th><th>Delta</th></thead>\n")
-	fmt.Printf("<tbody>\n")
-	for _, k := range keys {
-		delta := deltas[k]
-		rowBackground := "#fff"
-		cells := make([]string, 0)
-		cells = append(cells, k.metric, k.labels, oldMap[k].String(), newMap[k].String())
-		if oldMap[k].value != 0 {
-			if delta.isWarn {
-				rowBackground = "yellow"
-			}
-			if delta.isError {
-				rowBackground = "orange"
-			}
-			cells = append(cells, fmt.Sprintf("%0.4f%%", delta.percentChange))
-		} else {
-			cells = append(cells, "n/a")
-		}
-		fmt.Printf("<tr style=\"background: %s;\">\n", rowBackground)
-		for _, cell := range cells {
-			fmt.Printf("<td>%s</td>", cell)
-		}
-		fmt.Printf("\n</tr>\n")
+func writeJUnitFile(path string, comparison *metrics.Comparison) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "error creating junit file")
 	}
-	fmt.Printf("</tbody>\n</table>\n")
-}
-
-type oldNewDelta struct {
-	percentChange float64
-	isWarn        bool
-	isError       bool
-}
-
-type oldNewDeltaMap map[familyKey]oldNewDelta
-
-func getDeltas(keys []familyKey, oldMap, newMap metricMap, thresholds changeThresholds) oldNewDeltaMap {
-	deltas := make(oldNewDeltaMap)
-	for _, k := range keys {
-		newMetric := newMap[k]
-		oldMetric := oldMap[k]
-		if oldMetric.value != 0 {
-			percentChange := (newMetric.value - oldMetric.value) / oldMetric.value * 100
-			deltas[k] = oldNewDelta{
-				percentChange: percentChange,
-				isError:       thresholds.errorAt != 0.0 && math.Abs(percentChange) > thresholds.errorAt,
-				isWarn:        thresholds.warnAt != 0.0 && math.Abs(percentChange) > thresholds.warnAt,
-			}
-		} else {
-			deltas[k] = oldNewDelta{
-				isWarn:  false,
-				isError: false,
-			}
+	defer func() {
+		if closeErr := f.Close(); closeErr != nil && err == nil {
+			err = errors.Wrap(closeErr, "error closing junit file")
 		}
-	}
-
-	return deltas
+	}()
+	return metrics.WriteComparison(f, "junit", comparison)
 }
 
-func compareMetricMaps(oldMap, newMap metricMap, thresholds changeThresholds, opts *metricOptions) {
-	var keys []familyKey
-	for k := range oldMap {
-		if _, ok := newMap[k]; ok {
-			keys = append(keys, k)
+// expandGlobs replaces the file patterns by the files matching them. Stdin, URLs and paths without glob
+// characters are kept as is.
+func expandGlobs(patterns []string) ([]string, error) {
+	var files []string
+	for _, pattern := range patterns {
+		if pattern == metrics.StdinPath || strings.Contains(pattern, "://") || !strings.ContainsAny(pattern, `*?[`) {
+			files = append(files, pattern)
+			continue
 		}
-	}
-	sort.Slice(keys, func(i, j int) bool {
-		if keys[i].metric != keys[j].metric {
-			return keys[i].metric < keys[j].metric
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid glob %q", pattern)
 		}
-		return keys[i].labels < keys[j].labels
-	})
-
-	var deltas = getDeltas(keys, oldMap, newMap, thresholds)
-
-	switch opts.format {
-	case "plain":
-		stdoutPrint(keys, oldMap, newMap, deltas)
-	case "csv":
-		csvPrint(keys, oldMap, newMap, deltas)
-	case "html-table":
-		htmlTablePrint(keys, oldMap, newMap, deltas)
-	default:
-		panic("unknown output format")
-	}
-
-	for _, v := range deltas {
-		if v.isError {
-			os.Exit(1)
+		if len(matches) == 0 {
+			return nil, errors.Errorf("no files match %q", pattern)
 		}
+		files = append(files, matches...)
 	}
+	return files, nil
 }
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prom2json"
+	"github.com/spf13/cobra"
+	"github.com/stackrox/prometheus-metric-parser/pkg/gcp"
+	"github.com/stackrox/prometheus-metric-parser/pkg/influxdb"
+	"github.com/stackrox/prometheus-metric-parser/pkg/metrics"
+)
+
+type metricOptions struct {
+	metrics           string
+	minHistogramCount int
+	trimPrefix        string
+	format            string
+	labels            string
+	projectID         string
+	gcpBatchSize      int
+	gcpWorkers        int
+	gcpDistributions  bool
+	gcpValueType      string
+	gcpStartTime      int64
+	gcpMigrate        bool
+	gcpConfig         string
+	gcpMetricPrefix   string
+	gcpResourceType   string
+	gcpResourceLabels string
+	dryRun            bool
+	dryRunDir         string
+	timestamp         int64
+	quantiles         string
+	selectors         []string
+	excludes          []string
+	aggregate         string
+	influxDBFields    bool
+	influxDB          influxdb.Options
+}
+
+func addMetricFlags(c *cobra.Command) *metricOptions {
+	var opts metricOptions
+	c.Flags().StringVar(&opts.metrics, "metrics", "", "comma separate list of metrics to include in the results")
+	c.Flags().IntVar(&opts.minHistogramCount, "min-histogram-counts", 5, "minimum number of histogram counts to be completed in order for the metric to show up")
+	c.Flags().StringVar(&opts.trimPrefix, "trim-prefix-histogram-counts", "rox_central_", "prefix to automatically strip")
+	c.Flags().StringVar(&opts.format, "format", "plain", "format to output the metrics in (options are plain, csv, json, jsonl, influxdb or gcp-monitoring; compare supports plain, csv, json, jsonl, markdown, junit or html-table)")
+	c.Flags().StringVar(&opts.labels, "labels", "", "comma separate list of labels to include in ingest e.g. Test=ci-scale-test,ClusterFlavor=gke")
+	c.Flags().StringVar(&opts.projectID, "project-id", "", "where to send the metrics e.g. stackrox-ci")
+	c.Flags().Int64Var(&opts.timestamp, "timestamp", 0, "seconds since the epoch UTC")
+	c.Flags().StringVar(&opts.quantiles, "quantiles", "", "comma separated list of quantiles to calculate from histogram buckets e.g. 0.5,0.9,0.99")
+	c.Flags().StringArrayVar(&opts.selectors, "select", nil, `only include series matching this Prometheus selector e.g. 'rox_central_postgres_op_duration{Op="Get",Type=~"Deployment|Pod"}' (repeatable)`)
+	c.Flags().StringArrayVar(&opts.excludes, "exclude", nil, `exclude series matching this Prometheus selector e.g. '{__name__=~"go_.*"}' (repeatable)`)
+	c.Flags().StringVar(&opts.aggregate, "aggregate", "", "merge series per group before printing e.g. 'sum by (Type)' or 'max without (Op)'; histograms and summaries are always summed")
+	return &opts
+}
+
+// addSinkFlags adds the flags of writing the series to an InfluxDB server. Only the commands writing series register
+// them, so compare doesn't accept flags it would ignore.
+func addSinkFlags(c *cobra.Command, opts *metricOptions) {
+	c.Flags().BoolVar(&opts.influxDBFields, "influxdb-fields", false, "write each histogram and summary as one influxdb line with sum, count, mean and quantile fields")
+	c.Flags().StringVar(&opts.influxDB.URL, "influxdb-url", "", "write the influxdb format to this server instead of stdout e.g. http://localhost:8086")
+	c.Flags().StringVar(&opts.influxDB.Bucket, "influxdb-bucket", "", "InfluxDB v2 bucket to write to")
+	c.Flags().StringVar(&opts.influxDB.Org, "influxdb-org", "", "InfluxDB v2 organization of the bucket")
+	c.Flags().StringVar(&opts.influxDB.Token, "influxdb-token", "", "InfluxDB v2 API token (defaults to $INFLUXDB_TOKEN)")
+	c.Flags().StringVar(&opts.influxDB.Database, "influxdb-database", "", "InfluxDB v1 database to write to")
+	c.Flags().StringVar(&opts.influxDB.RetentionPolicy, "influxdb-retention-policy", "", "InfluxDB v1 retention policy of the database")
+	c.Flags().StringVar(&opts.influxDB.Username, "influxdb-username", "", "InfluxDB v1 user name")
+	c.Flags().StringVar(&opts.influxDB.Password, "influxdb-password", "", "InfluxDB v1 password (defaults to $INFLUXDB_PASSWORD)")
+	c.Flags().IntVar(&opts.influxDB.BatchSize, "influxdb-batch-size", influxdb.DefaultBatchSize, "maximum number of lines written to InfluxDB per request")
+	c.Flags().IntVar(&opts.influxDB.MaxRetries, "influxdb-retries", influxdb.DefaultMaxRetries, "number of retries of an InfluxDB request failing with a server error")
+}
+
+// addGCPFlags adds the flags of writing the series to GCP monitoring.
+func addGCPFlags(c *cobra.Command, opts *metricOptions) {
+	c.Flags().IntVar(&opts.gcpBatchSize, "gcp-batch-size", gcp.MaxSeriesPerRequest, "number of series written to GCP monitoring per request (at most 200)")
+	c.Flags().IntVar(&opts.gcpWorkers, "gcp-workers", gcp.DefaultWorkers, "number of concurrent requests writing series to GCP monitoring")
+	c.Flags().BoolVar(&opts.gcpDistributions, "gcp-distributions", false, "write histograms to GCP monitoring as DISTRIBUTION values with their buckets instead of their mean")
+	c.Flags().StringVar(&opts.gcpValueType, "gcp-value-type", "auto", "value type of counters and gauges in GCP monitoring: auto (int64 if all written values of a metric are integers), int64 or double")
+	c.Flags().Int64Var(&opts.gcpStartTime, "gcp-start-time", 0, "seconds since the epoch UTC the counters started, to write them as CUMULATIVE to GCP monitoring (defaults to process_start_time_seconds of the file)")
+	c.Flags().BoolVar(&opts.gcpMigrate, "gcp-migrate", false, "delete and recreate existing GCP metric descriptors, and with them their data, whose kind or value type changed")
+	c.Flags().StringVar(&opts.gcpConfig, "gcp-config", "", "yaml file with the metricPrefix, resourceType, resourceLabels and labelDescriptions (descriptions of the --labels) of GCP monitoring")
+	c.Flags().StringVar(&opts.gcpMetricPrefix, "gcp-metric-prefix", "", "prefix of the GCP monitoring metric types, overriding the config (default custom.googleapis.com/)")
+	c.Flags().StringVar(&opts.gcpResourceType, "gcp-resource-type", "", "monitored resource type of the GCP monitoring series e.g. generic_task, overriding the config (default global)")
+	c.Flags().StringVar(&opts.gcpResourceLabels, "gcp-resource-labels", "", "comma separated labels of the monitored resource, overriding the config e.g. location=us-east1,namespace=ci,job=scale-test,task_id=0")
+	c.Flags().BoolVar(&opts.dryRun, "dry-run", false, "validate the GCP monitoring requests against its limits and print them as JSON instead of sending them")
+	c.Flags().StringVar(&opts.dryRunDir, "dry-run-dir", "", "write each GCP monitoring request of a dry run as a JSON file to this directory instead of printing it (implies --dry-run)")
+}
+
+// toSeries filters the families by --metrics and turns them into series.
+func (opts *metricOptions) toSeries(families []*prom2json.Family) (metrics.Map, error) {
+	seriesOpts, err := opts.seriesOptions()
+	if err != nil {
+		return nil, err
+	}
+	return metrics.ToSeries(opts.filter(families), seriesOpts)
+}
+
+func (opts *metricOptions) seriesOptions() (metrics.Options, error) {
+	quantiles, err := metrics.ParseQuantiles(opts.quantiles)
+	if err != nil {
+		return metrics.Options{}, err
+	}
+	selectors, err := parseSelectors(opts.selectors)
+	if err != nil {
+		return metrics.Options{}, err
+	}
+	excludes, err := parseSelectors(opts.excludes)
+	if err != nil {
+		return metrics.Options{}, err
+	}
+	var aggregate *metrics.Aggregation
+	if opts.aggregate != "" {
+		if aggregate, err = metrics.ParseAggregation(opts.aggregate); err != nil {
+			return metrics.Options{}, err
+		}
+	}
+	return metrics.Options{
+		MinHistogramCount: opts.minHistogramCount,
+		TrimPrefix:        opts.trimPrefix,
+		Quantiles:         quantiles,
+		Select:            selectors,
+		Exclude:           excludes,
+		Aggregate:         aggregate,
+	}, nil
+}
+
+// writeSeries writes the series in --format to w, or to the InfluxDB server if an --influxdb-url is given.
+func (opts *metricOptions) writeSeries(w io.Writer, m metrics.Map) error {
+	writeOpts := metrics.WriteOptions{
+		Labels:         labelsFromOpts(opts.labels),
+		Timestamp:      opts.timestamp,
+		InfluxDBFields: opts.influxDBFields,
+	}
+	if opts.influxDB.URL == "" {
+		return metrics.WriteSeries(w, opts.format, m, writeOpts)
+	}
+	if opts.format != "influxdb" {
+		return errors.New("--influxdb-url requires --format influxdb")
+	}
+	// The credentials are read from the environment here rather than as flag defaults, which --help would print.
+	influxDBOpts := opts.influxDB
+	if influxDBOpts.Token == "" {
+		influxDBOpts.Token = os.Getenv("INFLUXDB_TOKEN")
+	}
+	if influxDBOpts.Password == "" {
+		influxDBOpts.Password = os.Getenv("INFLUXDB_PASSWORD")
+	}
+	client, err := influxdb.NewClient(influxDBOpts)
+	if err != nil {
+		return err
+	}
+	client.Progress = w
+	return client.WriteSeries(context.Background(), m, writeOpts)
+}
+
+func parseSelectors(raw []string) ([]*metrics.Selector, error) {
+	var selectors []*metrics.Selector
+	for _, r := range raw {
+		selector, err := metrics.ParseSelector(r)
+		if err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, selector)
+	}
+	return selectors, nil
+}
+
+// filter returns the families selected by --metrics.
+func (opts *metricOptions) filter(families []*prom2json.Family) []*prom2json.Family {
+	var names []string
+	if opts.metrics != "" {
+		names = strings.Split(opts.metrics, ",")
+	}
+	return metrics.Filter(families, names)
+}
+
+func addInputFlags(c *cobra.Command) *metrics.InputOptions {
+	var opts metrics.InputOptions
+	c.Flags().StringVar(&opts.BearerToken, "bearer-token", "", "bearer token to send when scraping an http(s) metrics endpoint")
+	c.Flags().StringVar(&opts.BearerTokenFile, "bearer-token-file", "", "file containing the bearer token to send when scraping an http(s) metrics endpoint")
+	c.Flags().StringVar(&opts.CAFile, "tls-ca-file", "", "PEM encoded CA bundle used to verify an https metrics endpoint")
+	c.Flags().DurationVar(&opts.Timeout, "scrape-timeout", 30*time.Second, "timeout when scraping an http(s) metrics endpoint")
+	c.Flags().BoolVar(&opts.Lenient, "lenient", false, "skip malformed metric families instead of failing")
+	return &opts
+}
+
+// readFile reads the metric families from path and logs the malformed families skipped in lenient mode.
+func readFile(path string, opts *metrics.InputOptions) ([]*prom2json.Family, error) {
+	families, dropped, err := metrics.ReadFile(path, *opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(dropped) > 0 {
+		for _, err := range dropped {
+			log.Printf("Skipping malformed metric family in %s: %v", path, err)
+		}
+		log.Printf("Skipped %d malformed metric families in %s", len(dropped), path)
+	}
+	return families, nil
+}
+
+func labelsFromOpts(optLabels string) map[string]string {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(optLabels, ",") {
+		x := strings.Split(pair, "=")
+		if len(x) == 2 {
+			name := strings.TrimSpace(x[0])
+			value := strings.TrimSpace(x[1])
+			if name != "" && value != "" {
+				labels[name] = value
+			}
+		}
+	}
+
+	return labels
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/stackrox/prometheus-metric-parser/pkg/gcp"
+	"github.com/stackrox/prometheus-metric-parser/pkg/metrics"
+)
+
+func gcpCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "gcp",
+		Short: "Gcp manages the custom metric descriptors in GCP monitoring",
+	}
+	c.AddCommand(gcpPruneCommand())
+	return c
+}
+
+func gcpPruneCommand() *cobra.Command {
+	var (
+		file         string
+		projectID    string
+		config       string
+		metricPrefix string
+		confirm      bool
+
+		inputOpts *metrics.InputOptions
+	)
+
+	c := &cobra.Command{
+		Use:   "prune",
+		Short: "Prune lists, or with --confirm deletes, the custom metric descriptors created by this tool, and with them their data, of families no longer in the metrics file",
+		RunE: func(c *cobra.Command, _ []string) error {
+			gcpConfig, err := loadGCPConfig(config, metricPrefix, "", "")
+			if err != nil {
+				return err
+			}
+			return gcpPrune(os.Stdout, file, projectID, gcpConfig, confirm, inputOpts)
+		},
+	}
+
+	c.Flags().StringVar(&file, "file", "", "file with all families still emitted, - for stdin or an http(s) URL to scrape")
+	c.Flags().StringVar(&projectID, "project-id", "", "project to prune the metric descriptors of e.g. stackrox-ci")
+	c.Flags().StringVar(&config, "gcp-config", "", "yaml file with the metricPrefix of the metric descriptors")
+	c.Flags().StringVar(&metricPrefix, "gcp-metric-prefix", "", "prefix of the metric types to prune, overriding the config (default custom.googleapis.com/)")
+	c.Flags().BoolVar(&confirm, "confirm", false, "delete the stale metric descriptors and their data instead of only printing them")
+
+	inputOpts = addInputFlags(c)
+	return c
+}
+
+func gcpPrune(w io.Writer, file, projectID string, config gcp.Config, confirm bool, inputOpts *metrics.InputOptions) error {
+	if file == "" {
+		return errors.New("file must be specified")
+	}
+	if projectID == "" {
+		return errors.New("a --project-id must be specified")
+	}
+	families, err := readFile(file, inputOpts)
+	if err != nil {
+		return err
+	}
+
+	client, err := gcp.Connect(context.Background(), projectID)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			log.Printf("Error closing GCP monitoring client: %+v", err)
+		}
+	}()
+	if err := config.Apply(client); err != nil {
+		return err
+	}
+	stale, err := client.StaleMetricDescriptors(families)
+	if err != nil {
+		return err
+	}
+	for _, md := range stale {
+		if _, err := fmt.Fprintln(w, md.GetType()); err != nil {
+			return err
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	if !confirm {
+		_, err := fmt.Fprintf(w, "Run with --confirm to delete these %d metric descriptors and their data\n", len(stale))
+		return err
+	}
+	client.Progress = w
+	_, _ = fmt.Fprintf(w, "Deleting %d metric descriptors", len(stale))
+	if err := client.DeleteMetricDescriptors(stale); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintln(w, "done")
+	return nil
+}
+
+// loadGCPConfig reads the config file, if any, and overrides it with the flags which are set.
+func loadGCPConfig(file, metricPrefix, resourceType, resourceLabels string) (gcp.Config, error) {
+	var config gcp.Config
+	if file != "" {
+		var err error
+		if config, err = gcp.LoadConfig(file); err != nil {
+			return gcp.Config{}, err
+		}
+	}
+	if metricPrefix != "" {
+		config.MetricPrefix = metricPrefix
+	}
+	if resourceType != "" {
+		config.ResourceType = resourceType
+	}
+	if resourceLabels != "" {
+		config.ResourceLabels = labelsFromOpts(resourceLabels)
+	}
+	return config, nil
+}
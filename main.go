@@ -1,13 +1,9 @@
 package main
 
 import (
-	"bytes"
-	dto "github.com/prometheus/client_model/go"
-	"github.com/prometheus/prom2json"
-	"github.com/spf13/cobra"
-
-	"log"
 	"os"
+
+	"github.com/spf13/cobra"
 )
 
 func main() {
@@ -19,29 +15,11 @@ func main() {
 	c.AddCommand(
 		singleCommand(),
 		compareCommand(),
+		rateCommand(),
+		gcpCommand(),
 	)
 
 	if err := c.Execute(); err != nil {
 		os.Exit(1)
 	}
 }
-
-func readFile(path string) ([]*prom2json.Family, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
-
-	mfChan := make(chan *dto.MetricFamily, 1024)
-	go func() {
-		if err := prom2json.ParseReader(bytes.NewReader(data), mfChan); err != nil {
-			log.Fatal("error reading metrics:", err)
-		}
-	}()
-
-	var result []*prom2json.Family
-	for mf := range mfChan {
-		result = append(result, prom2json.NewFamily(mf))
-	}
-	return result, nil
-}
@@ -0,0 +1,56 @@
+package gcp
+
+import (
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Config configures how metrics are written to Cloud Monitoring. Empty fields keep the defaults of the client.
+type Config struct {
+	MetricPrefix      string            `yaml:"metricPrefix"`
+	ResourceType      string            `yaml:"resourceType"`
+	ResourceLabels    map[string]string `yaml:"resourceLabels"`
+	LabelDescriptions map[string]string `yaml:"labelDescriptions"`
+}
+
+// LoadConfig reads the configuration from a yaml file.
+func LoadConfig(file string) (Config, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return Config{}, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var config Config
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil {
+		return Config{}, errors.Wrapf(err, "error decoding GCP config file %s", file)
+	}
+	return config, nil
+}
+
+// Apply sets the configured fields of the client.
+func (c Config) Apply(g *Client) error {
+	if c.MetricPrefix != "" {
+		if !strings.HasSuffix(c.MetricPrefix, "/") {
+			return errors.Errorf("metric prefix %s must end with a slash", c.MetricPrefix)
+		}
+		g.MetricPrefix = c.MetricPrefix
+	}
+	if c.ResourceType != "" {
+		g.ResourceType = c.ResourceType
+	}
+	if c.ResourceLabels != nil {
+		g.ResourceLabels = c.ResourceLabels
+	}
+	if c.LabelDescriptions != nil {
+		g.LabelDescriptions = c.LabelDescriptions
+	}
+	return nil
+}
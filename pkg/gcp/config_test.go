@@ -0,0 +1,83 @@
+package gcp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/prom2json"
+	"github.com/stackrox/prometheus-metric-parser/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const configYAML = `metricPrefix: custom.googleapis.com/stackrox/
+resourceType: generic_task
+resourceLabels:
+  location: us-east1
+  namespace: ci
+  job: scale-test
+  task_id: "0"
+labelDescriptions:
+  Test: The scale test.
+  Version: The version of StackRox.
+`
+
+func TestLoadConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "gcp.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(configYAML), 0o644))
+	config, err := LoadConfig(file)
+	require.NoError(t, err)
+	assert.Equal(t, Config{
+		MetricPrefix:      "custom.googleapis.com/stackrox/",
+		ResourceType:      "generic_task",
+		ResourceLabels:    map[string]string{"location": "us-east1", "namespace": "ci", "job": "scale-test", "task_id": "0"},
+		LabelDescriptions: map[string]string{"Test": "The scale test.", "Version": "The version of StackRox."},
+	}, config)
+
+	require.NoError(t, os.WriteFile(file, []byte("prefix: custom.googleapis.com/\n"), 0o644))
+	_, err = LoadConfig(file)
+	assert.Error(t, err, "unknown field")
+
+	assert.Error(t, Config{MetricPrefix: "custom.googleapis.com"}.Apply(&Client{}), "no trailing slash")
+}
+
+func TestClient_config(t *testing.T) {
+	gauge := &prom2json.Family{Name: "rox_central_objects", Type: "GAUGE", Metrics: []interface{}{
+		prom2json.Metric{Labels: map[string]string{"Test": "overridden"}, Value: "1"},
+	}}
+	labels := metrics.Labels{"Test": "overridden"}
+	m := metrics.Map{
+		{Metric: "objects", Labels: labels.String()}: {Name: "objects", Labels: labels, Value: 1, Family: gauge},
+	}
+
+	service := &fakeMetricService{}
+	client := connectFake(t, service)
+	require.NoError(t, Config{
+		MetricPrefix:      "custom.googleapis.com/stackrox/",
+		ResourceType:      "generic_task",
+		ResourceLabels:    map[string]string{"namespace": "ci", "job": "scale-test"},
+		LabelDescriptions: map[string]string{"Version": "The version of StackRox."},
+	}.Apply(client))
+	client.Labels = map[string]string{"Test": "ci", "Version": "4.4.0"}
+	require.NoError(t, client.CreateMetricDescriptors([]*prom2json.Family{gauge}, m, false))
+	require.NoError(t, client.WriteSeries(m, 1700000000))
+
+	md := service.descriptors[gauge.Name]
+	require.NotNil(t, md)
+	assert.Equal(t, "custom.googleapis.com/stackrox/rox_central_objects", md.GetType())
+	descriptions := make(map[string]string)
+	for _, l := range md.GetLabels() {
+		descriptions[l.GetKey()] = l.GetDescription()
+	}
+	assert.Equal(t, map[string]string{
+		"Test":    DefaultLabelDescriptions["Test"],
+		"Version": "The version of StackRox.",
+	}, descriptions, "labels are declared once")
+
+	ts := service.requests[0].GetTimeSeries()[0]
+	assert.Equal(t, "custom.googleapis.com/stackrox/rox_central_objects", ts.GetMetric().GetType())
+	assert.Equal(t, map[string]string{"Test": "overridden", "Version": "4.4.0"}, ts.GetMetric().GetLabels())
+	assert.Equal(t, "generic_task", ts.GetResource().GetType())
+	assert.Equal(t, map[string]string{"namespace": "ci", "job": "scale-test"}, ts.GetResource().GetLabels())
+}
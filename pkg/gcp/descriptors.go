@@ -0,0 +1,200 @@
+package gcp
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	monitoring "cloud.google.com/go/monitoring/apiv3/v2"
+	"cloud.google.com/go/monitoring/apiv3/v2/monitoringpb"
+	"github.com/googleapis/gax-go/v2"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prom2json"
+	"google.golang.org/api/iterator"
+	"google.golang.org/genproto/googleapis/api/label"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+)
+
+// descriptionMarker ends the description of every metric descriptor this tool creates. Only descriptors with it are
+// pruned, so descriptors of other tools sharing the metric prefix are never deleted.
+const descriptionMarker = "(prometheus-metric-parser)"
+
+// descriptorChange is what reconciling a metric descriptor did.
+type descriptorChange int
+
+const (
+	descriptorUnchanged descriptorChange = iota
+	descriptorCreated
+	descriptorUpdated
+)
+
+// apiService adapts the Cloud Monitoring client to metricService.
+type apiService struct {
+	*monitoring.MetricClient
+}
+
+// ListMetricDescriptors returns all pages of descriptors.
+func (s apiService) ListMetricDescriptors(ctx context.Context, req *monitoringpb.ListMetricDescriptorsRequest, opts ...gax.CallOption) ([]*metricpb.MetricDescriptor, error) {
+	var mds []*metricpb.MetricDescriptor
+	it := s.MetricClient.ListMetricDescriptors(ctx, req, opts...)
+	for {
+		md, err := it.Next()
+		if err == iterator.Done {
+			return mds, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		mds = append(mds, md)
+	}
+}
+
+// listMetricDescriptors returns the metric descriptors of the project by family name. Descriptors nested deeper below
+// the MetricPrefix belong to other tools and are ignored, as family names cannot contain a slash.
+func (g *Client) listMetricDescriptors() (map[string]*metricpb.MetricDescriptor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer cancel()
+
+	mds, err := g.client.ListMetricDescriptors(ctx, &monitoringpb.ListMetricDescriptorsRequest{
+		Name:   "projects/" + g.projectID,
+		Filter: `metric.type = starts_with("` + g.MetricPrefix + `")`,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing metric descriptors")
+	}
+	byFamily := make(map[string]*metricpb.MetricDescriptor, len(mds))
+	for _, md := range mds {
+		if name, ok := strings.CutPrefix(md.GetType(), g.MetricPrefix); ok && !strings.Contains(name, "/") {
+			byFamily[name] = md
+		}
+	}
+	return byFamily, nil
+}
+
+// reconcileMetricDescriptor creates the descriptor of the family if it doesn't exist, and updates it if labels were
+// added or its help text or unit changed. Labels of the existing descriptor are kept, as Cloud Monitoring cannot remove
+// them.
+func (g *Client) reconcileMetricDescriptor(family *prom2json.Family, values []float64, existing *metricpb.MetricDescriptor, withQuantiles bool) (descriptorChange, error) {
+	t, err := g.metricTypeOf(family, values)
+	if err != nil {
+		return 0, err
+	}
+	if t, existing, err = g.reconcileMetricType(existing, t); err != nil {
+		return 0, err
+	}
+	g.setMetricType(family, t)
+
+	md, err := g.metricDescriptor(family, withQuantiles, t)
+	if err != nil {
+		return 0, err
+	}
+	change := descriptorCreated
+	if existing != nil {
+		md.Labels = mergeLabels(existing.GetLabels(), md.GetLabels())
+		changes := descriptorChanges(existing, md)
+		if len(changes) == 0 {
+			return descriptorUnchanged, nil
+		}
+		g.progress("\nUpdating %s: %s\n", md.GetType(), strings.Join(changes, ", "))
+		change = descriptorUpdated
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer cancel()
+	_, err = g.client.CreateMetricDescriptor(ctx, &monitoringpb.CreateMetricDescriptorRequest{
+		Name:             "projects/" + g.projectID,
+		MetricDescriptor: md,
+	})
+	return change, err
+}
+
+// mergeLabels returns the existing labels followed by the desired labels which don't exist yet.
+func mergeLabels(existing, desired []*label.LabelDescriptor) []*label.LabelDescriptor {
+	merged := append([]*label.LabelDescriptor(nil), existing...)
+	keys := make(map[string]bool, len(existing))
+	for _, l := range existing {
+		keys[l.GetKey()] = true
+	}
+	for _, l := range desired {
+		if !keys[l.GetKey()] {
+			merged = append(merged, l)
+		}
+	}
+	return merged
+}
+
+// descriptorChanges describes the changes of the desired descriptor compared to the existing one, other than its kind
+// and value type.
+func descriptorChanges(existing, desired *metricpb.MetricDescriptor) []string {
+	var changes []string
+	if added := len(desired.GetLabels()) - len(existing.GetLabels()); added > 0 {
+		var keys []string
+		for _, l := range desired.GetLabels()[len(existing.GetLabels()):] {
+			keys = append(keys, l.GetKey())
+		}
+		changes = append(changes, "labels "+strings.Join(keys, ", ")+" added")
+	}
+	if existing.GetDescription() != desired.GetDescription() {
+		changes = append(changes, "help text changed")
+	}
+	if existing.GetUnit() != desired.GetUnit() {
+		changes = append(changes, "unit changed from "+existing.GetUnit()+" to "+desired.GetUnit())
+	}
+	return changes
+}
+
+// description returns the description of a descriptor with the help text, ending with the descriptionMarker.
+func description(help string) string {
+	if help == "" {
+		return descriptionMarker
+	}
+	return help + " " + descriptionMarker
+}
+
+// StaleMetricDescriptors returns the metric descriptors of the project with the MetricPrefix and the descriptionMarker
+// without a family in families, sorted by type. It returns an error if there are no families, as the input is more
+// likely broken than all metrics removed, and pruning would delete every descriptor.
+func (g *Client) StaleMetricDescriptors(families []*prom2json.Family) ([]*metricpb.MetricDescriptor, error) {
+	if len(families) == 0 {
+		return nil, errors.New("refusing to prune the metric descriptors of an input without metric families")
+	}
+	existing, err := g.listMetricDescriptors()
+	if err != nil {
+		return nil, err
+	}
+	for _, family := range families {
+		delete(existing, family.Name)
+	}
+	stale := make([]*metricpb.MetricDescriptor, 0, len(existing))
+	for _, md := range existing {
+		if strings.HasSuffix(md.GetDescription(), descriptionMarker) {
+			stale = append(stale, md)
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool {
+		return stale[i].GetType() < stale[j].GetType()
+	})
+	return stale, nil
+}
+
+// DeleteMetricDescriptors deletes the descriptors, and with them their data. It returns the first error, but tries
+// to delete all descriptors.
+func (g *Client) DeleteMetricDescriptors(mds []*metricpb.MetricDescriptor) error {
+	var errs []error
+	for _, md := range mds {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+		err := g.client.DeleteMetricDescriptor(ctx, &monitoringpb.DeleteMetricDescriptorRequest{
+			Name: "projects/" + g.projectID + "/metricDescriptors/" + md.GetType(),
+		})
+		cancel()
+		if err != nil {
+			errs = append(errs, errors.Wrap(err, "error deleting metric descriptor "+md.GetType()))
+		}
+		g.progress(".")
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errors.Wrapf(errs[0], "%d of %d metric descriptors could not be deleted", len(errs), len(mds))
+}
@@ -0,0 +1,83 @@
+package gcp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/prometheus/prom2json"
+	"github.com/stackrox/prometheus-metric-parser/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/api/label"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestClient_CreateMetricDescriptors_reconcile(t *testing.T) {
+	families := parseFamilies(t, typesSample)
+	requests := families["rox_central_requests_total"]
+	memory := families["process_resident_memory_bytes"]
+	cpu := families["process_cpu_fraction"]
+	m, err := metrics.ToSeries([]*prom2json.Family{requests, memory, cpu}, metrics.Options{})
+	require.NoError(t, err)
+
+	// The descriptors as created by a previous run.
+	labels := map[string]string{"Test": "ci", "ClusterFlavor": "gke"}
+	service := &fakeMetricService{}
+	client := connectFake(t, service)
+	client.Labels = labels
+	require.NoError(t, client.CreateMetricDescriptors([]*prom2json.Family{requests, memory, cpu}, m, false))
+	require.Len(t, service.created, 3)
+
+	changed := proto.Clone(service.descriptors[requests.Name]).(*metricpb.MetricDescriptor)
+	changed.Labels = changed.Labels[:len(changed.Labels)-1]
+	changed.Labels = append(changed.Labels, &label.LabelDescriptor{Key: "Removed"})
+	changed.Description = "Old help"
+	service.descriptors[requests.Name] = changed
+	delete(service.descriptors, cpu.Name)
+	service.created = nil
+
+	var progress bytes.Buffer
+	client = connectFake(t, service)
+	client.Labels = labels
+	client.Progress = &progress
+	require.NoError(t, client.CreateMetricDescriptors([]*prom2json.Family{requests, memory, cpu}, m, false))
+
+	assert.Equal(t, []string{"custom.googleapis.com/rox_central_requests_total", "custom.googleapis.com/process_cpu_fraction"},
+		service.created, "unchanged descriptors are not written")
+	var keys []string
+	for _, l := range service.descriptors[requests.Name].GetLabels() {
+		keys = append(keys, l.GetKey())
+	}
+	assert.Equal(t, []string{"ClusterFlavor", "Test", "Removed", "Op"}, keys, "existing labels are kept")
+	assert.Contains(t, progress.String(), "Updating custom.googleapis.com/rox_central_requests_total: labels Op added, help text changed\n")
+	assert.Contains(t, progress.String(), "done, 1 created, 1 updated, 1 unchanged\n")
+}
+
+func TestClient_StaleMetricDescriptors(t *testing.T) {
+	families := parseFamilies(t, typesSample)
+	service := &fakeMetricService{descriptors: map[string]*metricpb.MetricDescriptor{
+		"process_cpu_fraction":    {Type: "custom.googleapis.com/process_cpu_fraction", Description: descriptionMarker},
+		"rox_central_removed":     {Type: "custom.googleapis.com/rox_central_removed", Description: description("Removed.")},
+		"rox_central_old_removed": {Type: "custom.googleapis.com/rox_central_old_removed", Description: descriptionMarker},
+		"other_tool":              {Type: "custom.googleapis.com/other/tool", Description: descriptionMarker},
+		"other_tool_metric":       {Type: "custom.googleapis.com/other_tool_metric", Description: "Written by another tool."},
+	}}
+	client := connectFake(t, service)
+
+	stale, err := client.StaleMetricDescriptors([]*prom2json.Family{families["process_cpu_fraction"], families["process_resident_memory_bytes"]})
+	require.NoError(t, err)
+	require.Len(t, stale, 2, "descriptors nested below the prefix or without the marker are not pruned")
+	assert.Equal(t, "custom.googleapis.com/rox_central_old_removed", stale[0].GetType())
+	assert.Equal(t, "custom.googleapis.com/rox_central_removed", stale[1].GetType())
+
+	require.NoError(t, client.DeleteMetricDescriptors(stale))
+	assert.Equal(t, []string{
+		"projects/test-project/metricDescriptors/custom.googleapis.com/rox_central_old_removed",
+		"projects/test-project/metricDescriptors/custom.googleapis.com/rox_central_removed",
+	}, service.deleted)
+	assert.Len(t, service.descriptors, 3)
+
+	_, err = client.StaleMetricDescriptors(nil)
+	assert.ErrorContains(t, err, "without metric families", "an empty input doesn't prune every descriptor")
+}
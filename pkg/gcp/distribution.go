@@ -0,0 +1,49 @@
+package gcp
+
+import (
+	"math"
+
+	"github.com/stackrox/prometheus-metric-parser/pkg/metrics"
+	"google.golang.org/genproto/googleapis/api/distribution"
+)
+
+// distributionValue converts a histogram series into a distribution with explicit bucket bounds.
+//
+// Prometheus buckets are cumulative and named after their upper bound, while Cloud Monitoring counts the observations
+// per bucket: the finite upper bounds become the explicit bounds, the first bucket counts the observations up to the
+// first bound and the overflow bucket those above the last bound, i.e. the +Inf bucket. Prometheus does not record
+// the sum of squared deviation, so it is left 0.
+func distributionValue(series metrics.Series) *distribution.Distribution {
+	d := &distribution.Distribution{
+		Count: int64(math.Round(series.Count)),
+	}
+	if series.Count > 0 {
+		d.Mean = series.Sum / series.Count
+	}
+
+	var bounds []float64
+	var counts []int64
+	var previous int64
+	for _, b := range series.Buckets {
+		if math.IsInf(b.UpperBound, 1) {
+			break
+		}
+		// Rounding the cumulative counts rather than the differences keeps the bucket counts adding up to the count.
+		cumulative := int64(math.Round(b.Count))
+		bounds = append(bounds, b.UpperBound)
+		counts = append(counts, cumulative-previous)
+		previous = cumulative
+	}
+	if len(bounds) == 0 {
+		return d
+	}
+	counts = append(counts, d.Count-previous)
+
+	d.BucketOptions = &distribution.Distribution_BucketOptions{
+		Options: &distribution.Distribution_BucketOptions_ExplicitBuckets{
+			ExplicitBuckets: &distribution.Distribution_BucketOptions_Explicit{Bounds: bounds},
+		},
+	}
+	d.BucketCounts = counts
+	return d
+}
@@ -0,0 +1,73 @@
+package gcp
+
+import (
+	"math"
+	"testing"
+
+	"github.com/prometheus/prom2json"
+	"github.com/stackrox/prometheus-metric-parser/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+)
+
+func TestDistributionValue(t *testing.T) {
+	d := distributionValue(metrics.Series{
+		Sum:   300,
+		Count: 100,
+		Buckets: []metrics.Bucket{
+			{UpperBound: 1, Count: 10},
+			{UpperBound: 5, Count: 60},
+			{UpperBound: 10, Count: 90},
+			{UpperBound: math.Inf(1), Count: 100},
+		},
+	})
+	assert.Equal(t, int64(100), d.GetCount())
+	assert.Equal(t, 3.0, d.GetMean())
+	assert.Equal(t, []float64{1, 5, 10}, d.GetBucketOptions().GetExplicitBuckets().GetBounds())
+	assert.Equal(t, []int64{10, 50, 30, 10}, d.GetBucketCounts())
+
+	d = distributionValue(metrics.Series{
+		Sum:     10,
+		Count:   4.5,
+		Buckets: []metrics.Bucket{{UpperBound: 1, Count: 1.5}, {UpperBound: 2, Count: 3.5}},
+	})
+	assert.Equal(t, int64(5), d.GetCount())
+	assert.Equal(t, []int64{2, 2, 1}, d.GetBucketCounts(), "the bucket counts add up to the rounded count")
+
+	d = distributionValue(metrics.Series{Sum: 10, Count: 5})
+	assert.Nil(t, d.GetBucketOptions(), "no buckets")
+	assert.Equal(t, 2.0, d.GetMean())
+}
+
+func TestClient_WriteSeries_distributions(t *testing.T) {
+	histogram := &prom2json.Family{Name: "rox_central_op_duration", Type: "HISTOGRAM"}
+	labels := metrics.Labels{"Op": "Get"}
+	quantileLabels := metrics.Labels{"Op": "Get", metrics.QuantileLabel: "0.5"}
+	buckets := []metrics.Bucket{{UpperBound: 1, Count: 1}, {UpperBound: math.Inf(1), Count: 2}}
+	m := metrics.Map{
+		{Metric: "op_duration", Labels: labels.String()}: {
+			Name: "op_duration", Labels: labels, Value: 1.5, Sum: 3, Count: 2, Buckets: buckets, Family: histogram,
+		},
+		{Metric: "op_duration", Labels: quantileLabels.String()}: {
+			Name: "op_duration", Labels: quantileLabels, Value: 1, Sum: 3, Count: 2, Family: histogram,
+		},
+	}
+
+	service := &fakeMetricService{}
+	client := connectFake(t, service)
+	client.Distributions = true
+	require.NoError(t, client.WriteSeries(m, 1700000000))
+
+	require.Len(t, service.requests, 1)
+	series := service.requests[0].GetTimeSeries()
+	require.Len(t, series, 1, "quantile series are not written")
+	d := series[0].GetPoints()[0].GetValue().GetDistributionValue()
+	require.NotNil(t, d)
+	assert.Equal(t, int64(2), d.GetCount())
+	assert.Equal(t, []int64{1, 1}, d.GetBucketCounts())
+
+	mt, err := client.metricTypeOf(histogram, nil)
+	require.NoError(t, err)
+	assert.Equal(t, metricpb.MetricDescriptor_DISTRIBUTION, mt.valueType)
+}
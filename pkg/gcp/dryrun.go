@@ -0,0 +1,109 @@
+package gcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"cloud.google.com/go/monitoring/apiv3/v2/monitoringpb"
+	"github.com/googleapis/gax-go/v2"
+	"github.com/pkg/errors"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// DryRun creates a client which validates the requests against the limits of Cloud Monitoring and writes them as
+// protojson instead of sending them, either to w or, if dir is set, one file per request to dir. No descriptors are
+// assumed to exist, series are written by a single worker so the output is stable, and any invalid request fails the
+// writes.
+func DryRun(projectID string, w io.Writer, dir string) (*Client, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, errors.Wrap(err, "error creating dry run directory")
+		}
+	}
+	return &Client{
+		projectID:    projectID,
+		client:       &dryRunService{w: w, dir: dir},
+		BatchSize:    MaxSeriesPerRequest,
+		Workers:      1,
+		MetricPrefix: DefaultMetricPrefix,
+		ResourceType: DefaultResourceType,
+		strict:       true,
+	}, nil
+}
+
+// dryRunService validates and writes the requests.
+type dryRunService struct {
+	w   io.Writer
+	dir string
+
+	mu       sync.Mutex
+	requests int
+}
+
+func (d *dryRunService) ListMetricDescriptors(context.Context, *monitoringpb.ListMetricDescriptorsRequest, ...gax.CallOption) ([]*metricpb.MetricDescriptor, error) {
+	return nil, nil
+}
+
+func (d *dryRunService) CreateMetricDescriptor(_ context.Context, req *monitoringpb.CreateMetricDescriptorRequest, _ ...gax.CallOption) (*metricpb.MetricDescriptor, error) {
+	if err := d.write("CreateMetricDescriptor", req, validateMetricDescriptor(req.GetMetricDescriptor())); err != nil {
+		return nil, err
+	}
+	return req.GetMetricDescriptor(), nil
+}
+
+func (d *dryRunService) DeleteMetricDescriptor(_ context.Context, req *monitoringpb.DeleteMetricDescriptorRequest, _ ...gax.CallOption) error {
+	return d.write("DeleteMetricDescriptor", req, nil)
+}
+
+func (d *dryRunService) CreateTimeSeries(_ context.Context, req *monitoringpb.CreateTimeSeriesRequest, _ ...gax.CallOption) error {
+	return d.write("CreateTimeSeries", req, validateTimeSeries(req))
+}
+
+func (d *dryRunService) Close() error {
+	return nil
+}
+
+// write writes the request, even if invalid, and returns the violations of the limits as INVALID_ARGUMENT.
+func (d *dryRunService) write(method string, req proto.Message, violations []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.requests++
+
+	raw, err := protojson.Marshal(req)
+	if err != nil {
+		return errors.Wrapf(err, "error marshalling %s request", method)
+	}
+	// protojson output is deliberately unstable, so it is normalized for golden tests.
+	var compact, out bytes.Buffer
+	if err := json.Compact(&compact, raw); err != nil {
+		return errors.Wrapf(err, "error formatting %s request", method)
+	}
+	if err := json.Indent(&out, compact.Bytes(), "", "  "); err != nil {
+		return errors.Wrapf(err, "error formatting %s request", method)
+	}
+	out.WriteByte('\n')
+
+	if d.dir != "" {
+		path := filepath.Join(d.dir, fmt.Sprintf("%04d-%s.json", d.requests, method))
+		if err := os.WriteFile(path, out.Bytes(), 0o644); err != nil {
+			return errors.Wrapf(err, "error writing %s", path)
+		}
+	} else if _, err := fmt.Fprintf(d.w, "# %s\n%s", method, out.Bytes()); err != nil {
+		return errors.Wrapf(err, "error writing %s request", method)
+	}
+
+	if len(violations) > 0 {
+		return status.Errorf(codes.InvalidArgument, "invalid %s request: %v", method, violations)
+	}
+	return nil
+}
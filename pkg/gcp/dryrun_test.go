@@ -0,0 +1,140 @@
+package gcp
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/prom2json"
+	"github.com/stackrox/prometheus-metric-parser/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const dryRunOutput = `# CreateMetricDescriptor
+{
+  "name": "projects/test-project",
+  "metricDescriptor": {
+    "name": "Process Cpu Fraction",
+    "type": "custom.googleapis.com/process_cpu_fraction",
+    "labels": [
+      {
+        "key": "Test",
+        "description": "The test performed. e.g. ci-scale"
+      }
+    ],
+    "metricKind": "GAUGE",
+    "valueType": "DOUBLE",
+    "unit": "1",
+    "description": "(prometheus-metric-parser)",
+    "displayName": "Process Cpu Fraction"
+  }
+}
+# CreateTimeSeries
+{
+  "name": "projects/test-project",
+  "timeSeries": [
+    {
+      "metric": {
+        "type": "custom.googleapis.com/process_cpu_fraction",
+        "labels": {
+          "Test": "ci-scale"
+        }
+      },
+      "resource": {
+        "type": "global"
+      },
+      "points": [
+        {
+          "interval": {
+            "endTime": "2023-11-14T22:13:20Z"
+          },
+          "value": {
+            "doubleValue": 0.7
+          }
+        }
+      ]
+    }
+  ]
+}
+`
+
+func TestDryRun(t *testing.T) {
+	families := parseFamilies(t, typesSample)
+	cpu := families["process_cpu_fraction"]
+	series := metrics.Map{
+		{Metric: cpu.Name}: {Name: cpu.Name, Labels: metrics.Labels{}, Value: 0.7, Family: cpu},
+	}
+
+	t.Run("writer", func(t *testing.T) {
+		var buf bytes.Buffer
+		client, err := DryRun("test-project", &buf, "")
+		require.NoError(t, err)
+		client.Labels = map[string]string{"Test": "ci-scale"}
+		require.NoError(t, client.CreateMetricDescriptors([]*prom2json.Family{cpu}, series, false))
+		require.NoError(t, client.WriteSeries(series, 1700000000))
+		assert.Equal(t, dryRunOutput, buf.String())
+	})
+
+	t.Run("directory", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "requests")
+		client, err := DryRun("test-project", nil, dir)
+		require.NoError(t, err)
+		client.Labels = map[string]string{"Test": "ci-scale"}
+		require.NoError(t, client.CreateMetricDescriptors([]*prom2json.Family{cpu}, series, false))
+		require.NoError(t, client.WriteSeries(series, 1700000000))
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		assert.Equal(t, []string{"0001-CreateMetricDescriptor.json", "0002-CreateTimeSeries.json"}, names)
+		data, err := os.ReadFile(filepath.Join(dir, names[1]))
+		require.NoError(t, err)
+		assert.Equal(t, dryRunOutput[strings.Index(dryRunOutput, "# CreateTimeSeries\n")+len("# CreateTimeSeries\n"):], string(data))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		invalid := &prom2json.Family{Name: "rox_central_" + strings.Repeat("x", MaxMetricTypeLength), Type: "GAUGE"}
+		labels := metrics.Labels{"bad-key": "v", "_leading": "v", "long": strings.Repeat("v", MaxLabelValueLength+1)}
+		m := metrics.Map{
+			{Metric: "x", Labels: labels.String()}: {Name: "x", Labels: labels, Value: 1, Family: invalid},
+		}
+
+		var buf bytes.Buffer
+		client, err := DryRun("test-project", &buf, "")
+		require.NoError(t, err)
+		err = client.WriteSeries(m, 1700000000)
+		require.Error(t, err, "any invalid request fails a dry run")
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		assert.Contains(t, err.Error(), "is longer than 200 characters")
+		assert.Contains(t, err.Error(), `label key "bad-key"`)
+		assert.Contains(t, err.Error(), `label key "_leading"`, "label keys must start with a letter")
+		assert.Contains(t, err.Error(), "value of label long")
+		assert.Contains(t, buf.String(), "# CreateTimeSeries", "invalid requests are written too")
+	})
+}
+
+func TestValidateMetricDescriptor(t *testing.T) {
+	families := parseFamilies(t, typesSample)
+	client, err := DryRun("test-project", &bytes.Buffer{}, "")
+	require.NoError(t, err)
+	client.Labels = map[string]string{"Test": "ci", "ClusterFlavor": "gke"}
+	md, err := client.metricDescriptor(families["rox_central_requests_total"], true,
+		metricType{kind: metricpb.MetricDescriptor_GAUGE, valueType: metricpb.MetricDescriptor_INT64})
+	require.NoError(t, err)
+	assert.Empty(t, validateMetricDescriptor(md))
+
+	for i := 0; i < MaxLabels; i++ {
+		md.Labels = append(md.Labels, md.Labels[0])
+	}
+	assert.Equal(t, []string{"metric custom.googleapis.com/rox_central_requests_total has 34 labels, more than 30"},
+		validateMetricDescriptor(md))
+}
@@ -0,0 +1,84 @@
+package gcp
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"cloud.google.com/go/monitoring/apiv3/v2/monitoringpb"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+)
+
+// Limits of custom metrics, see https://cloud.google.com/monitoring/quotas#custom_metrics_quotas.
+const (
+	// MaxLabels is the maximum number of labels of a metric descriptor.
+	MaxLabels = 30
+	// MaxMetricTypeLength is the maximum length of the type of a metric descriptor.
+	MaxMetricTypeLength = 200
+	// MaxLabelKeyLength is the maximum length of a label key.
+	MaxLabelKeyLength = 100
+	// MaxLabelValueLength is the maximum length of a label value.
+	MaxLabelValueLength = 1024
+)
+
+var labelKeyPattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
+
+// validateMetricDescriptor returns the violations of the limits of Cloud Monitoring by the descriptor.
+func validateMetricDescriptor(md *metricpb.MetricDescriptor) []string {
+	var violations []string
+	if len(md.GetType()) > MaxMetricTypeLength {
+		violations = append(violations, fmt.Sprintf("metric type %s is longer than %d characters", md.GetType(), MaxMetricTypeLength))
+	}
+	if len(md.GetLabels()) > MaxLabels {
+		violations = append(violations, fmt.Sprintf("metric %s has %d labels, more than %d", md.GetType(), len(md.GetLabels()), MaxLabels))
+	}
+	for _, l := range md.GetLabels() {
+		violations = append(violations, validateLabelKey(md.GetType(), l.GetKey())...)
+	}
+	return violations
+}
+
+// validateTimeSeries returns the violations of the limits of Cloud Monitoring by the request.
+func validateTimeSeries(req *monitoringpb.CreateTimeSeriesRequest) []string {
+	var violations []string
+	if len(req.GetTimeSeries()) > MaxSeriesPerRequest {
+		violations = append(violations, fmt.Sprintf("request has %d series, more than %d", len(req.GetTimeSeries()), MaxSeriesPerRequest))
+	}
+	for _, ts := range req.GetTimeSeries() {
+		metricType := ts.GetMetric().GetType()
+		labels := ts.GetMetric().GetLabels()
+		if len(metricType) > MaxMetricTypeLength {
+			violations = append(violations, fmt.Sprintf("metric type %s is longer than %d characters", metricType, MaxMetricTypeLength))
+		}
+		if len(labels) > MaxLabels {
+			violations = append(violations, fmt.Sprintf("series of %s has %d labels, more than %d", metricType, len(labels), MaxLabels))
+		}
+		for _, key := range sortedKeys(labels) {
+			violations = append(violations, validateLabelKey(metricType, key)...)
+			if len(labels[key]) > MaxLabelValueLength {
+				violations = append(violations, fmt.Sprintf("value of label %s of %s is longer than %d characters", key, metricType, MaxLabelValueLength))
+			}
+		}
+	}
+	return violations
+}
+
+func validateLabelKey(metricType, key string) []string {
+	var violations []string
+	if !labelKeyPattern.MatchString(key) {
+		violations = append(violations, fmt.Sprintf("label key %q of %s must match %s", key, metricType, labelKeyPattern))
+	}
+	if len(key) > MaxLabelKeyLength {
+		violations = append(violations, fmt.Sprintf("label key %s of %s is longer than %d characters", key, metricType, MaxLabelKeyLength))
+	}
+	return violations
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
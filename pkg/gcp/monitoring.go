@@ -0,0 +1,447 @@
+// Package gcp writes metric series to Google Cloud Monitoring as custom metrics.
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+
+	monitoring "cloud.google.com/go/monitoring/apiv3/v2"
+	"cloud.google.com/go/monitoring/apiv3/v2/monitoringpb"
+	"github.com/googleapis/gax-go/v2"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prom2json"
+	"github.com/stackrox/prometheus-metric-parser/pkg/metrics"
+	"google.golang.org/api/option"
+	"google.golang.org/genproto/googleapis/api/label"
+	google_metric "google.golang.org/genproto/googleapis/api/metric"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+	"google.golang.org/genproto/googleapis/api/monitoredres"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	timestamp "google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// DefaultMetricPrefix is the prefix of the metric types of a new client.
+	DefaultMetricPrefix = "custom.googleapis.com/"
+	// DefaultResourceType is the monitored resource type of a new client.
+	DefaultResourceType = "global"
+	// MaxSeriesPerRequest is the maximum number of time series Cloud Monitoring accepts in a CreateTimeSeries request.
+	MaxSeriesPerRequest = 200
+	// DefaultWorkers is the number of concurrent CreateTimeSeries requests of a new client.
+	DefaultWorkers = 4
+)
+
+// Client writes metric descriptors and series to the custom metrics of a project.
+type Client struct {
+	projectID string
+	client    metricService
+
+	// Progress receives a dot per request, if set.
+	Progress io.Writer
+	// BatchSize is the number of series written per request, at most MaxSeriesPerRequest.
+	BatchSize int
+	// Workers is the number of concurrent requests writing series.
+	Workers int
+	// MaxRetries is the number of retries of a request failing with a retryable code, e.g. UNAVAILABLE.
+	MaxRetries int
+	// RetryBackoff is the wait before the first retry, doubled for every further retry.
+	RetryBackoff time.Duration
+	// Distributions writes histograms as DISTRIBUTION values with their buckets instead of their mean. Histogram
+	// quantile series are not written then, as Cloud Monitoring calculates percentiles from the distribution.
+	Distributions bool
+	// ValueType forces the value type of counters and gauges to INT64 or DOUBLE. If unspecified, it is INT64 if all
+	// values of the series of a family are integers and DOUBLE otherwise.
+	ValueType metricpb.MetricDescriptor_ValueType
+	// StartTime is the time in seconds since the epoch the counters started counting, usually the start of the
+	// process. Counters are written as CUMULATIVE metrics if it is set and as GAUGE otherwise.
+	StartTime int64
+	// Migrate deletes existing metric descriptors, and with them their data, whose kind or value type differ from the
+	// desired ones. Otherwise the existing kind and value type are kept if possible.
+	Migrate bool
+	// Labels are added to every series, unless the series has a label of the same name, and declared in every
+	// metric descriptor.
+	Labels map[string]string
+	// LabelDescriptions are the descriptions of the Labels in the metric descriptors.
+	LabelDescriptions map[string]string
+	// MetricPrefix is the prefix of the metric types, e.g. custom.googleapis.com/stackrox/. Only descriptors with
+	// this prefix are reconciled or pruned.
+	MetricPrefix string
+	// ResourceType is the monitored resource type of the series, e.g. generic_task.
+	ResourceType string
+	// ResourceLabels are the labels of the monitored resource, e.g. the namespace and job of a generic_task.
+	ResourceLabels map[string]string
+
+	// types are the kind and value type of each family written.
+	types map[string]metricType
+	// strict fails on any error instead of allowing 5% of the writes to fail, as a dry run does.
+	strict bool
+}
+
+// metricService is the part of the Cloud Monitoring API used by the client, implemented by the API client and by
+// the dry run.
+type metricService interface {
+	ListMetricDescriptors(ctx context.Context, req *monitoringpb.ListMetricDescriptorsRequest, opts ...gax.CallOption) ([]*metricpb.MetricDescriptor, error)
+	CreateMetricDescriptor(ctx context.Context, req *monitoringpb.CreateMetricDescriptorRequest, opts ...gax.CallOption) (*metricpb.MetricDescriptor, error)
+	DeleteMetricDescriptor(ctx context.Context, req *monitoringpb.DeleteMetricDescriptorRequest, opts ...gax.CallOption) error
+	CreateTimeSeries(ctx context.Context, req *monitoringpb.CreateTimeSeriesRequest, opts ...gax.CallOption) error
+	Close() error
+}
+
+// DefaultLabelDescriptions are the descriptions of common labels not in Client.LabelDescriptions.
+var DefaultLabelDescriptions = map[string]string{
+	"Test":          "The test performed. e.g. ci-scale",
+	"ClusterFlavor": "The cluster flavor used. e.g. gke-default",
+}
+
+// Connect creates a client for the project using the application default credentials, unless overridden by opts.
+func Connect(ctx context.Context, projectID string, opts ...option.ClientOption) (*Client, error) {
+	client, err := monitoring.NewMetricClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		projectID:    projectID,
+		client:       apiService{client},
+		BatchSize:    MaxSeriesPerRequest,
+		Workers:      DefaultWorkers,
+		MaxRetries:   3,
+		RetryBackoff: time.Second,
+		MetricPrefix: DefaultMetricPrefix,
+		ResourceType: DefaultResourceType,
+	}, nil
+}
+
+// Close closes the connection to GCP monitoring.
+func (g *Client) Close() error {
+	return g.client.Close()
+}
+
+func (g *Client) progress(format string, args ...interface{}) {
+	if g.Progress != nil {
+		_, _ = fmt.Fprintf(g.Progress, format, args...)
+	}
+}
+
+// CreateMetricDescriptors reconciles a custom metric descriptor for each family with series in m, the series to be
+// written, with the existing descriptors of the project, which are listed once. Families without series, e.g. filtered
+// out by a selector, are left alone, as their value type cannot be inferred. Missing descriptors are created,
+// descriptors with added labels or a changed help text or unit are updated and unchanged ones are left alone.
+// Summaries, and histograms if withQuantiles is set and they are not written as distributions, get a quantile label.
+// Incompatible changes are reported to Progress, and an error is returned if more than 5% of the families failed.
+func (g *Client) CreateMetricDescriptors(families []*prom2json.Family, m metrics.Map, withQuantiles bool) error {
+	g.progress("Creating metric descriptors")
+	existing, err := g.listMetricDescriptors()
+	if err != nil {
+		return err
+	}
+	var (
+		errs       []error
+		changes    = make(map[descriptorChange]int)
+		values     = seriesValues(m)
+		reconciled int
+	)
+	for _, family := range families {
+		if _, ok := values[family.Name]; !ok {
+			continue
+		}
+		reconciled++
+		change, err := g.reconcileMetricDescriptor(family, values[family.Name], existing[family.Name],
+			family.Type == "SUMMARY" || (withQuantiles && family.Type == "HISTOGRAM" && !g.Distributions))
+		if err != nil {
+			err = errors.Wrap(err, "error creating custom metric: "+family.Name)
+			g.progress("\n%v\n", err)
+			errs = append(errs, err)
+		} else {
+			changes[change]++
+		}
+		g.progress(".")
+	}
+	g.progress("done, %d created, %d updated, %d unchanged\n",
+		changes[descriptorCreated], changes[descriptorUpdated], changes[descriptorUnchanged])
+	if len(errs) == 0 {
+		return nil
+	}
+	return g.checkErrorBudget(reconciled, len(errs), errs[0])
+}
+
+// WriteSeries writes the value of each series at the timestamp, with the Labels added to those of the series.
+// The series are written in batches by concurrent workers, and batches failing with a retryable code are retried
+// with exponential backoff. It returns an error if more than 5% of the series failed.
+func (g *Client) WriteSeries(m metrics.Map, timestamp int64) error {
+	g.progress("Writing metrics")
+	var (
+		errs   []error
+		series []*monitoringpb.TimeSeries
+		values = seriesValues(m)
+	)
+	for _, k := range m.SortedKeys() {
+		if _, isQuantile := m[k].Labels[metrics.QuantileLabel]; isQuantile && g.writesDistribution(m[k]) {
+			continue
+		}
+		ts, err := g.timeSeries(m[k], values[m[k].Family.Name], timestamp)
+		if err != nil {
+			errs = append(errs, errors.Wrap(err, "error writing metric: "+m[k].Name))
+			continue
+		}
+		series = append(series, ts)
+	}
+	failed := len(errs)
+	total := failed + len(series)
+
+	batchSize := g.BatchSize
+	if batchSize <= 0 || batchSize > MaxSeriesPerRequest {
+		batchSize = MaxSeriesPerRequest
+	}
+	batches := make(chan []*monitoringpb.TimeSeries)
+	go func() {
+		defer close(batches)
+		for start := 0; start < len(series); start += batchSize {
+			batches <- series[start:min(start+batchSize, len(series))]
+		}
+	}()
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for i := 0; i < max(g.Workers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				err := g.createTimeSeries(batch)
+				mu.Lock()
+				if err != nil {
+					errs = append(errs, errors.Wrapf(err, "error writing %d metrics starting with %s", len(batch), batch[0].GetMetric().GetType()))
+					failed += failedSeries(err, len(batch))
+				}
+				g.progress(".")
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	g.progress("done\n")
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return g.checkErrorBudget(total, failed, errs[0])
+}
+
+// createTimeSeries writes a batch of series, retrying with exponential backoff on retryable codes.
+func (g *Client) createTimeSeries(batch []*monitoringpb.TimeSeries) error {
+	req := &monitoringpb.CreateTimeSeriesRequest{
+		Name:       "projects/" + g.projectID,
+		TimeSeries: batch,
+	}
+	backoff := g.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+		err := g.client.CreateTimeSeries(ctx, req)
+		cancel()
+		if err == nil || !isRetryable(err) || attempt >= g.MaxRetries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// isRetryable returns whether a request failing with err may succeed when retried.
+func isRetryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return true
+	default:
+		return false
+	}
+}
+
+// failedSeries returns the number of series of a batch of size n which failed with err. Cloud Monitoring reports
+// how many points of a partially failed request were written, otherwise all series are assumed to have failed.
+func failedSeries(err error, n int) int {
+	st, ok := status.FromError(err)
+	if !ok {
+		return n
+	}
+	for _, detail := range st.Details() {
+		if summary, ok := detail.(*monitoringpb.CreateTimeSeriesSummary); ok && summary.GetTotalPointCount() > 0 {
+			return int(summary.GetTotalPointCount() - summary.GetSuccessPointCount())
+		}
+	}
+	return n
+}
+
+// checkErrorBudget returns err if more than 5% of the total requests or series failed, or if any failed in strict
+// mode.
+func (g *Client) checkErrorBudget(total, failed int, err error) error {
+	if g.strict {
+		return errors.Wrapf(err, "%d of %d GCP writes failed", failed, total)
+	}
+	// This is a way to calculate 5% to avoid division/multiplying float numbers.
+	// Divide both sides by 20 * total and you'll get:
+	// 0.05 < failed / total
+	if total < 20*failed {
+		return errors.Wrapf(err, "%d of %d GCP writes failed, more than 5%%", failed, total)
+	}
+	return nil
+}
+
+// metricDescriptor returns the descriptor of the family written as t.
+func (g *Client) metricDescriptor(family *prom2json.Family, withQuantiles bool, t metricType) (*metricpb.MetricDescriptor, error) {
+	metricName := cases.Title(language.Und).String(strings.ReplaceAll(family.Name, "_", " "))
+
+	var labels []*label.LabelDescriptor
+	added := make(map[string]bool)
+	for _, key := range sortedKeys(g.Labels) {
+		description, ok := g.LabelDescriptions[key]
+		if !ok {
+			description = DefaultLabelDescriptions[key]
+		}
+		labels = append(labels, &label.LabelDescriptor{
+			Key:         key,
+			ValueType:   label.LabelDescriptor_STRING,
+			Description: description,
+		})
+		added[key] = true
+	}
+	if withQuantiles {
+		labels = append(labels, &label.LabelDescriptor{
+			Key:         metrics.QuantileLabel,
+			ValueType:   label.LabelDescriptor_STRING,
+			Description: "The quantile of the histogram or summary. e.g. 0.99",
+		})
+		added[metrics.QuantileLabel] = true
+	}
+	for _, familyMetric := range family.Metrics {
+
+		var metricLabels map[string]string
+		switch family.Type {
+		case "HISTOGRAM":
+			metricLabels = familyMetric.(prom2json.Histogram).Labels
+		case "SUMMARY":
+			metricLabels = familyMetric.(prom2json.Summary).Labels
+		case "COUNTER", "GAUGE":
+			metricLabels = familyMetric.(prom2json.Metric).Labels
+		default:
+			return nil, errors.Errorf("unexpected family type: %v", family.Type)
+		}
+
+		for _, labelName := range sortedKeys(metricLabels) {
+			if _, ok := added[labelName]; !ok {
+				labels = append(labels, &label.LabelDescriptor{
+					Key:         labelName,
+					ValueType:   label.LabelDescriptor_STRING,
+					Description: "",
+				})
+				added[labelName] = true
+			}
+		}
+	}
+
+	// Unit fudgery - Rox should/could communicate this in the metrics dump
+	unit := "1"
+	if strings.HasSuffix(family.Name, "_duration") {
+		unit = "ms"
+	}
+
+	return &google_metric.MetricDescriptor{
+		Name:        metricName,
+		Type:        g.MetricPrefix + family.Name,
+		Labels:      labels,
+		MetricKind:  t.kind,
+		ValueType:   t.valueType,
+		Unit:        unit,
+		Description: description(family.Help),
+		DisplayName: metricName,
+	}, nil
+}
+
+// writesDistribution returns whether the series belongs to a histogram written as distribution.
+func (g *Client) writesDistribution(series metrics.Series) bool {
+	return g.Distributions && series.Family != nil && series.Family.Type == "HISTOGRAM"
+}
+
+// timeSeries returns the point of the series at ts, with the Labels added to those of the series. The values are those
+// of all series of its family.
+func (g *Client) timeSeries(series metrics.Series, values []float64, ts int64) (*monitoringpb.TimeSeries, error) {
+	endTime := &timestamp.Timestamp{
+		Seconds: ts,
+	}
+
+	labels := make(map[string]string)
+	for labelKey, labelValue := range g.Labels {
+		labels[labelKey] = labelValue
+	}
+	for labelKey, labelValue := range series.Labels {
+		labels[labelKey] = labelValue
+	}
+
+	resourceLabels := make(map[string]string, len(g.ResourceLabels))
+	for labelKey, labelValue := range g.ResourceLabels {
+		resourceLabels[labelKey] = labelValue
+	}
+
+	t, err := g.metricTypeOf(series.Family, values)
+	if err != nil {
+		return nil, err
+	}
+	interval := &monitoringpb.TimeInterval{
+		EndTime: endTime,
+	}
+	if t.kind == google_metric.MetricDescriptor_CUMULATIVE {
+		if g.StartTime >= ts {
+			return nil, errors.Errorf("start time %d of the counter must be before the timestamp %d", g.StartTime, ts)
+		}
+		interval.StartTime = &timestamp.Timestamp{Seconds: g.StartTime}
+	}
+
+	var value *monitoringpb.TypedValue
+	switch t.valueType {
+	case google_metric.MetricDescriptor_DISTRIBUTION:
+		value = &monitoringpb.TypedValue{
+			Value: &monitoringpb.TypedValue_DistributionValue{
+				DistributionValue: distributionValue(series),
+			},
+		}
+	case google_metric.MetricDescriptor_DOUBLE:
+		value = &monitoringpb.TypedValue{
+			Value: &monitoringpb.TypedValue_DoubleValue{
+				DoubleValue: series.Value,
+			},
+		}
+	case google_metric.MetricDescriptor_INT64:
+		value = &monitoringpb.TypedValue{
+			Value: &monitoringpb.TypedValue_Int64Value{
+				Int64Value: int64(math.Round(series.Value)),
+			},
+		}
+	default:
+		return nil, errors.Errorf("unexpected metric descriptor value type: %v", t.valueType)
+	}
+
+	return &monitoringpb.TimeSeries{
+		Metric: &metricpb.Metric{
+			Type:   g.MetricPrefix + series.Family.Name,
+			Labels: labels,
+		},
+		Resource: &monitoredres.MonitoredResource{
+			Type:   g.ResourceType,
+			Labels: resourceLabels,
+		},
+		Points: []*monitoringpb.Point{{
+			Interval: interval,
+			Value:    value,
+		}},
+	}, nil
+}
@@ -0,0 +1,233 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/monitoring/apiv3/v2/monitoringpb"
+	"github.com/prometheus/prom2json"
+	"github.com/stackrox/prometheus-metric-parser/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// fakeMetricService keeps the metric descriptors, records the created descriptors and time series requests and fails them with the error
+// returned by fail, if set.
+type fakeMetricService struct {
+	monitoringpb.UnimplementedMetricServiceServer
+
+	mu          sync.Mutex
+	descriptors map[string]*metricpb.MetricDescriptor
+	created     []string
+	deleted     []string
+	requests    []*monitoringpb.CreateTimeSeriesRequest
+	fail        func(call int, req *monitoringpb.CreateTimeSeriesRequest) error
+}
+
+func (f *fakeMetricService) ListMetricDescriptors(_ context.Context, _ *monitoringpb.ListMetricDescriptorsRequest) (*monitoringpb.ListMetricDescriptorsResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	resp := &monitoringpb.ListMetricDescriptorsResponse{}
+	for _, md := range f.descriptors {
+		resp.MetricDescriptors = append(resp.MetricDescriptors, md)
+	}
+	return resp, nil
+}
+
+func (f *fakeMetricService) CreateMetricDescriptor(_ context.Context, req *monitoringpb.CreateMetricDescriptorRequest) (*metricpb.MetricDescriptor, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	md := req.GetMetricDescriptor()
+	if existing, ok := f.descriptors[path.Base(md.GetType())]; ok &&
+		(existing.GetMetricKind() != md.GetMetricKind() || existing.GetValueType() != md.GetValueType()) {
+		return nil, status.Errorf(codes.InvalidArgument, "cannot change the kind or value type of %s", md.GetType())
+	}
+	if f.descriptors == nil {
+		f.descriptors = make(map[string]*metricpb.MetricDescriptor)
+	}
+	f.descriptors[path.Base(md.GetType())] = md
+	f.created = append(f.created, md.GetType())
+	return md, nil
+}
+
+func (f *fakeMetricService) DeleteMetricDescriptor(_ context.Context, req *monitoringpb.DeleteMetricDescriptorRequest) (*emptypb.Empty, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.descriptors, path.Base(req.GetName()))
+	f.deleted = append(f.deleted, req.GetName())
+	return &emptypb.Empty{}, nil
+}
+
+func (f *fakeMetricService) CreateTimeSeries(_ context.Context, req *monitoringpb.CreateTimeSeriesRequest) (*emptypb.Empty, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, req)
+	if f.fail != nil {
+		if err := f.fail(len(f.requests), req); err != nil {
+			return nil, err
+		}
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// written returns the number of series in all requests.
+func (f *fakeMetricService) written() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, req := range f.requests {
+		n += len(req.GetTimeSeries())
+	}
+	return n
+}
+
+func connectFake(t *testing.T, service *fakeMetricService) *Client {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	monitoringpb.RegisterMetricServiceServer(server, service)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+
+	client, err := Connect(context.Background(), "test-project", option.WithGRPCConn(conn))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	client.RetryBackoff = time.Millisecond
+	return client
+}
+
+func testSeries(n int) metrics.Map {
+	gauge := &prom2json.Family{Name: "rox_central_objects", Type: "GAUGE"}
+	m := make(metrics.Map)
+	for i := 0; i < n; i++ {
+		labels := metrics.Labels{"Index": fmt.Sprint(i)}
+		m[metrics.Key{Metric: "objects", Labels: labels.String()}] = metrics.Series{
+			Name:   "objects",
+			Labels: labels,
+			Value:  float64(i),
+			Family: gauge,
+		}
+	}
+	return m
+}
+
+func TestClient_WriteSeries(t *testing.T) {
+	service := &fakeMetricService{}
+	client := connectFake(t, service)
+	client.Labels = map[string]string{"Test": "ci"}
+
+	require.NoError(t, client.WriteSeries(testSeries(450), 1700000000))
+
+	require.Len(t, service.requests, 3)
+	sizes := make(map[int]int)
+	for _, req := range service.requests {
+		assert.Equal(t, "projects/test-project", req.GetName())
+		sizes[len(req.GetTimeSeries())]++
+		for _, ts := range req.GetTimeSeries() {
+			assert.Equal(t, "custom.googleapis.com/rox_central_objects", ts.GetMetric().GetType())
+			assert.Equal(t, "ci", ts.GetMetric().GetLabels()["Test"])
+			assert.Equal(t, int64(1700000000), ts.GetPoints()[0].GetInterval().GetEndTime().GetSeconds())
+		}
+	}
+	assert.Equal(t, map[int]int{200: 2, 50: 1}, sizes)
+}
+
+func TestClient_WriteSeries_retries(t *testing.T) {
+	service := &fakeMetricService{fail: func(call int, _ *monitoringpb.CreateTimeSeriesRequest) error {
+		if call <= 2 {
+			return status.Error(codes.Unavailable, "try again")
+		}
+		return nil
+	}}
+	client := connectFake(t, service)
+	client.Workers = 1
+
+	require.NoError(t, client.WriteSeries(testSeries(10), 1700000000))
+	assert.Len(t, service.requests, 3)
+	assert.Equal(t, 30, service.written(), "the batch is retried as a whole")
+}
+
+func TestClient_WriteSeries_errorBudget(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		fail     func(call int, req *monitoringpb.CreateTimeSeriesRequest) error
+		requests int
+		wantErr  string
+	}{
+		{
+			name: "non-retryable batch failure exceeds the budget",
+			fail: func(_ int, req *monitoringpb.CreateTimeSeriesRequest) error {
+				if req.GetTimeSeries()[0].GetMetric().GetLabels()["Index"] == "0" {
+					return status.Error(codes.InvalidArgument, "bad labels")
+				}
+				return nil
+			},
+			requests: 2,
+			wantErr:  "200 of 400 GCP writes failed, more than 5%: error writing 200 metrics starting with custom.googleapis.com/rox_central_objects: rpc error: code = InvalidArgument desc = bad labels",
+		},
+		{
+			name: "partial failure within the budget",
+			fail: func(_ int, req *monitoringpb.CreateTimeSeriesRequest) error {
+				if req.GetTimeSeries()[0].GetMetric().GetLabels()["Index"] != "0" {
+					return nil
+				}
+				st, err := status.New(codes.InvalidArgument, "one point failed").WithDetails(&monitoringpb.CreateTimeSeriesSummary{
+					TotalPointCount:   200,
+					SuccessPointCount: 190,
+				})
+				require.NoError(t, err)
+				return st.Err()
+			},
+			requests: 2,
+		},
+		{
+			name: "retries exhausted",
+			fail: func(_ int, req *monitoringpb.CreateTimeSeriesRequest) error {
+				if req.GetTimeSeries()[0].GetMetric().GetLabels()["Index"] == "0" {
+					return status.Error(codes.ResourceExhausted, "quota")
+				}
+				return nil
+			},
+			requests: 5,
+			wantErr:  "200 of 400 GCP writes failed, more than 5%",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &fakeMetricService{fail: tt.fail}
+			client := connectFake(t, service)
+
+			err := client.WriteSeries(testSeries(400), 1700000000)
+			assert.Len(t, service.requests, tt.requests)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
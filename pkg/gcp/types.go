@@ -0,0 +1,160 @@
+package gcp
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/monitoring/apiv3/v2/monitoringpb"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prom2json"
+	"github.com/stackrox/prometheus-metric-parser/pkg/metrics"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+)
+
+// processStartTimeFamily is the gauge exported by the Prometheus client libraries with the start of the process.
+const processStartTimeFamily = "process_start_time_seconds"
+
+// metricType is the kind and value type a family is written with.
+type metricType struct {
+	kind      metricpb.MetricDescriptor_MetricKind
+	valueType metricpb.MetricDescriptor_ValueType
+}
+
+// ProcessStartTime returns the process_start_time_seconds of the families, if present.
+func ProcessStartTime(families []*prom2json.Family) (int64, bool) {
+	for _, family := range families {
+		if family.Name != processStartTimeFamily || len(family.Metrics) == 0 {
+			continue
+		}
+		m, ok := family.Metrics[0].(prom2json.Metric)
+		if !ok {
+			continue
+		}
+		value, err := strconv.ParseFloat(m.Value, 64)
+		if err != nil || value <= 0 {
+			continue
+		}
+		return int64(value), true
+	}
+	return 0, false
+}
+
+// metricTypeOf returns the kind and value type the family is written with, given the values of its series. It is
+// decided once per family, so the descriptor and the series of a family agree.
+func (g *Client) metricTypeOf(family *prom2json.Family, values []float64) (metricType, error) {
+	if t, ok := g.types[family.Name]; ok {
+		return t, nil
+	}
+	t, err := g.desiredMetricType(family, values)
+	if err != nil {
+		return metricType{}, err
+	}
+	g.setMetricType(family, t)
+	return t, nil
+}
+
+func (g *Client) setMetricType(family *prom2json.Family, t metricType) {
+	if g.types == nil {
+		g.types = make(map[string]metricType)
+	}
+	g.types[family.Name] = t
+}
+
+// desiredMetricType returns the kind and value type of the family regardless of an existing descriptor. Counters are
+// CUMULATIVE if a start time is known, everything else is a GAUGE. Counters and gauges are INT64 if all values of their
+// series are integers, DOUBLE otherwise, unless the value type is forced.
+func (g *Client) desiredMetricType(family *prom2json.Family, values []float64) (metricType, error) {
+	t := metricType{kind: metricpb.MetricDescriptor_GAUGE}
+	switch family.Type {
+	case "HISTOGRAM":
+		t.valueType = metricpb.MetricDescriptor_DOUBLE
+		if g.Distributions {
+			t.valueType = metricpb.MetricDescriptor_DISTRIBUTION
+		}
+	case "SUMMARY":
+		t.valueType = metricpb.MetricDescriptor_DOUBLE
+	case "COUNTER", "GAUGE":
+		if family.Type == "COUNTER" && g.StartTime > 0 {
+			t.kind = metricpb.MetricDescriptor_CUMULATIVE
+		}
+		t.valueType = g.ValueType
+		if t.valueType == metricpb.MetricDescriptor_VALUE_TYPE_UNSPECIFIED {
+			t.valueType = inferValueType(values)
+		}
+	default:
+		return metricType{}, errors.Errorf("unexpected family type: %s", family.Type)
+	}
+	return t, nil
+}
+
+// seriesValues returns the values of the series per family. The value type is inferred from them rather than from the
+// samples of the family, as an aggregated series, e.g. an average, is not integral even if the samples are.
+func seriesValues(m metrics.Map) map[string][]float64 {
+	values := make(map[string][]float64)
+	for _, series := range m {
+		if series.Family != nil {
+			values[series.Family.Name] = append(values[series.Family.Name], series.Value)
+		}
+	}
+	return values
+}
+
+// inferValueType returns INT64 if there are values and all are integers which a float64 represents exactly, DOUBLE
+// otherwise. Any value can be written as DOUBLE, so a family without series doesn't get an INT64 descriptor.
+func inferValueType(values []float64) metricpb.MetricDescriptor_ValueType {
+	if len(values) == 0 {
+		return metricpb.MetricDescriptor_DOUBLE
+	}
+	for _, value := range values {
+		if value != math.Trunc(value) || math.Abs(value) > 1<<53 {
+			return metricpb.MetricDescriptor_DOUBLE
+		}
+	}
+	return metricpb.MetricDescriptor_INT64
+}
+
+// reconcileMetricType compares the desired type of the family with the existing descriptor, if any. If they differ,
+// the existing descriptor is deleted if Migrate is set. Otherwise its type is kept if the series can be converted,
+// i.e. INT64 and DOUBLE values are converted into each other and counters are written as GAUGE, and an error is
+// returned if not. It returns the type to write and the descriptor which still exists.
+func (g *Client) reconcileMetricType(existing *metricpb.MetricDescriptor, desired metricType) (metricType, *metricpb.MetricDescriptor, error) {
+	if existing == nil {
+		return desired, nil, nil
+	}
+	current := metricType{kind: existing.GetMetricKind(), valueType: existing.GetValueType()}
+	if current == desired {
+		return desired, existing, nil
+	}
+
+	if g.Migrate {
+		g.progress("\nMigrating %s from %s %s to %s %s\n", existing.GetType(),
+			current.kind, current.valueType, desired.kind, desired.valueType)
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+		defer cancel()
+		name := "projects/" + g.projectID + "/metricDescriptors/" + existing.GetType()
+		if err := g.client.DeleteMetricDescriptor(ctx, &monitoringpb.DeleteMetricDescriptorRequest{Name: name}); err != nil {
+			return metricType{}, nil, errors.Wrap(err, "error deleting metric descriptor to migrate it")
+		}
+		return desired, nil, nil
+	}
+
+	if current.kind != desired.kind && current.kind != metricpb.MetricDescriptor_GAUGE {
+		return metricType{}, nil, errors.Errorf("existing metric descriptor is %s instead of %s, migrate it to change the kind",
+			current.kind, desired.kind)
+	}
+	if current.valueType != desired.valueType && (!isNumeric(current.valueType) || !isNumeric(desired.valueType)) {
+		return metricType{}, nil, errors.Errorf("existing metric descriptor has value type %s instead of %s, migrate it to change the value type",
+			current.valueType, desired.valueType)
+	}
+	if current.valueType == metricpb.MetricDescriptor_INT64 && desired.valueType == metricpb.MetricDescriptor_DOUBLE {
+		g.progress("\nKeeping INT64 value type of existing %s, values are rounded; migrate it to change the value type\n",
+			existing.GetType())
+	}
+	return current, existing, nil
+}
+
+func isNumeric(valueType metricpb.MetricDescriptor_ValueType) bool {
+	return valueType == metricpb.MetricDescriptor_INT64 || valueType == metricpb.MetricDescriptor_DOUBLE
+}
@@ -0,0 +1,186 @@
+package gcp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/prom2json"
+	"github.com/stackrox/prometheus-metric-parser/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+)
+
+const typesSample = `# TYPE process_start_time_seconds gauge
+process_start_time_seconds 1.7134619e+09
+# TYPE process_resident_memory_bytes gauge
+process_resident_memory_bytes 1.48399176e+08
+# TYPE process_cpu_fraction gauge
+process_cpu_fraction 0.7
+# TYPE rox_central_requests_total counter
+rox_central_requests_total{Op="Get"} 100
+rox_central_requests_total{Op="Upsert"} 50
+`
+
+func parseFamilies(t *testing.T, text string) map[string]*prom2json.Family {
+	families, _, err := metrics.Parse(strings.NewReader(text), false)
+	require.NoError(t, err)
+	byName := make(map[string]*prom2json.Family)
+	for _, family := range families {
+		byName[family.Name] = family
+	}
+	return byName
+}
+
+func TestProcessStartTime(t *testing.T) {
+	families, _, err := metrics.Parse(strings.NewReader(typesSample), false)
+	require.NoError(t, err)
+	start, ok := ProcessStartTime(families)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1713461900), start)
+
+	_, ok = ProcessStartTime(families[1:])
+	assert.False(t, ok)
+}
+
+func TestClient_desiredMetricType(t *testing.T) {
+	families := parseFamilies(t, typesSample)
+	for _, tt := range []struct {
+		name      string
+		client    Client
+		family    string
+		values    []float64
+		kind      metricpb.MetricDescriptor_MetricKind
+		valueType metricpb.MetricDescriptor_ValueType
+	}{
+		{name: "integral gauge", family: "process_resident_memory_bytes", values: []float64{1.48399176e+08}, kind: metricpb.MetricDescriptor_GAUGE, valueType: metricpb.MetricDescriptor_INT64},
+		{name: "fractional gauge", family: "process_cpu_fraction", values: []float64{0.7}, kind: metricpb.MetricDescriptor_GAUGE, valueType: metricpb.MetricDescriptor_DOUBLE},
+		{name: "aggregated gauge", family: "process_resident_memory_bytes", values: []float64{1.5}, kind: metricpb.MetricDescriptor_GAUGE, valueType: metricpb.MetricDescriptor_DOUBLE},
+		{name: "gauge without series", family: "process_resident_memory_bytes", kind: metricpb.MetricDescriptor_GAUGE, valueType: metricpb.MetricDescriptor_DOUBLE},
+		{name: "counter without start time", family: "rox_central_requests_total", values: []float64{100, 50}, kind: metricpb.MetricDescriptor_GAUGE, valueType: metricpb.MetricDescriptor_INT64},
+		{name: "counter with start time", client: Client{StartTime: 1}, family: "rox_central_requests_total", values: []float64{100, 50}, kind: metricpb.MetricDescriptor_CUMULATIVE, valueType: metricpb.MetricDescriptor_INT64},
+		{name: "forced value type", client: Client{ValueType: metricpb.MetricDescriptor_DOUBLE}, family: "process_resident_memory_bytes", values: []float64{1.48399176e+08}, kind: metricpb.MetricDescriptor_GAUGE, valueType: metricpb.MetricDescriptor_DOUBLE},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mt, err := tt.client.desiredMetricType(families[tt.family], tt.values)
+			require.NoError(t, err)
+			assert.Equal(t, tt.kind, mt.kind)
+			assert.Equal(t, tt.valueType, mt.valueType)
+		})
+	}
+}
+
+func TestClient_CreateMetricDescriptors_aggregated(t *testing.T) {
+	families := parseFamilies(t, `# TYPE rox_central_objects gauge
+rox_central_objects{Type="Pod"} 1
+rox_central_objects{Type="Deployment"} 2
+`)
+	objects := families["rox_central_objects"]
+	m, err := metrics.ToSeries([]*prom2json.Family{objects}, metrics.Options{Aggregate: &metrics.Aggregation{Op: metrics.AggregateAvg}})
+	require.NoError(t, err)
+
+	service := &fakeMetricService{}
+	client := connectFake(t, service)
+	require.NoError(t, client.CreateMetricDescriptors([]*prom2json.Family{objects}, m, false))
+	require.NoError(t, client.WriteSeries(m, 1700000000))
+
+	assert.Equal(t, metricpb.MetricDescriptor_DOUBLE, service.descriptors[objects.Name].GetValueType(),
+		"the average of integral samples is not integral")
+	assert.Equal(t, 1.5, service.requests[0].GetTimeSeries()[0].GetPoints()[0].GetValue().GetDoubleValue())
+}
+
+func TestClient_CreateMetricDescriptors_migration(t *testing.T) {
+	families := parseFamilies(t, typesSample)
+	cpu := families["process_cpu_fraction"]
+	series := metrics.Map{
+		{Metric: cpu.Name}: {Name: cpu.Name, Labels: metrics.Labels{}, Value: 0.7, Family: cpu},
+	}
+	existing := func(valueType metricpb.MetricDescriptor_ValueType) map[string]*metricpb.MetricDescriptor {
+		return map[string]*metricpb.MetricDescriptor{cpu.Name: {
+			Type:       "custom.googleapis.com/" + cpu.Name,
+			MetricKind: metricpb.MetricDescriptor_GAUGE,
+			ValueType:  valueType,
+		}}
+	}
+
+	t.Run("keeps the existing value type", func(t *testing.T) {
+		service := &fakeMetricService{descriptors: existing(metricpb.MetricDescriptor_INT64)}
+		client := connectFake(t, service)
+		require.NoError(t, client.CreateMetricDescriptors([]*prom2json.Family{cpu}, series, false))
+		require.NoError(t, client.WriteSeries(series, 1700000000))
+
+		assert.Empty(t, service.deleted)
+		assert.Equal(t, metricpb.MetricDescriptor_INT64, service.descriptors[cpu.Name].GetValueType())
+		assert.Equal(t, int64(1), service.requests[0].GetTimeSeries()[0].GetPoints()[0].GetValue().GetInt64Value(), "rounded")
+	})
+
+	t.Run("migrates", func(t *testing.T) {
+		service := &fakeMetricService{descriptors: existing(metricpb.MetricDescriptor_INT64)}
+		client := connectFake(t, service)
+		client.Migrate = true
+		require.NoError(t, client.CreateMetricDescriptors([]*prom2json.Family{cpu}, series, false))
+		require.NoError(t, client.WriteSeries(series, 1700000000))
+
+		assert.Equal(t, []string{"projects/test-project/metricDescriptors/custom.googleapis.com/" + cpu.Name}, service.deleted)
+		assert.Equal(t, metricpb.MetricDescriptor_DOUBLE, service.descriptors[cpu.Name].GetValueType())
+		assert.Equal(t, 0.7, service.requests[0].GetTimeSeries()[0].GetPoints()[0].GetValue().GetDoubleValue())
+	})
+
+	t.Run("incompatible", func(t *testing.T) {
+		service := &fakeMetricService{descriptors: existing(metricpb.MetricDescriptor_DISTRIBUTION)}
+		client := connectFake(t, service)
+		err := client.CreateMetricDescriptors([]*prom2json.Family{cpu}, series, false)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "existing metric descriptor has value type DISTRIBUTION instead of DOUBLE")
+	})
+}
+
+func TestClient_CreateMetricDescriptors_filteredFamily(t *testing.T) {
+	families := parseFamilies(t, typesSample)
+	cpu := families["process_cpu_fraction"]
+	memory := families["process_resident_memory_bytes"]
+	series := metrics.Map{
+		{Metric: cpu.Name}: {Name: cpu.Name, Labels: metrics.Labels{}, Value: 0.7, Family: cpu},
+	}
+	existing := &metricpb.MetricDescriptor{
+		Type:       "custom.googleapis.com/" + memory.Name,
+		MetricKind: metricpb.MetricDescriptor_GAUGE,
+		ValueType:  metricpb.MetricDescriptor_INT64,
+	}
+
+	var progress bytes.Buffer
+	service := &fakeMetricService{descriptors: map[string]*metricpb.MetricDescriptor{memory.Name: existing}}
+	client := connectFake(t, service)
+	client.Migrate = true
+	client.Progress = &progress
+	require.NoError(t, client.CreateMetricDescriptors([]*prom2json.Family{cpu, memory}, series, false))
+
+	assert.Empty(t, service.deleted, "a family without series is not migrated")
+	assert.Equal(t, []string{"custom.googleapis.com/" + cpu.Name}, service.created)
+	assert.Same(t, existing, service.descriptors[memory.Name])
+	assert.NotContains(t, progress.String(), memory.Name)
+}
+
+func TestClient_WriteSeries_cumulative(t *testing.T) {
+	families := parseFamilies(t, typesSample)
+	requests := families["rox_central_requests_total"]
+	labels := metrics.Labels{"Op": "Get"}
+	series := metrics.Map{
+		{Metric: "requests_total", Labels: labels.String()}: {Name: "requests_total", Labels: labels, Value: 100, Family: requests},
+	}
+
+	service := &fakeMetricService{}
+	client := connectFake(t, service)
+	client.StartTime = 1713461900
+	require.NoError(t, client.CreateMetricDescriptors([]*prom2json.Family{requests}, series, false))
+	require.NoError(t, client.WriteSeries(series, 1713462000))
+
+	assert.Equal(t, metricpb.MetricDescriptor_CUMULATIVE, service.descriptors[requests.Name].GetMetricKind())
+	interval := service.requests[0].GetTimeSeries()[0].GetPoints()[0].GetInterval()
+	assert.Equal(t, int64(1713461900), interval.GetStartTime().GetSeconds())
+	assert.Equal(t, int64(1713462000), interval.GetEndTime().GetSeconds())
+
+	client.StartTime = 1713462000
+	assert.Error(t, client.WriteSeries(series, 1713462000), "the start time must be before the end time")
+}
@@ -0,0 +1,256 @@
+// Package influxdb writes metric series to an InfluxDB server using the v1 or v2 HTTP write API.
+package influxdb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stackrox/prometheus-metric-parser/pkg/metrics"
+)
+
+const (
+	// DefaultBatchSize is the number of lines written per request if Options.BatchSize is not set.
+	DefaultBatchSize = 5000
+	// DefaultMaxRetries is the suggested number of retries of a failed request.
+	DefaultMaxRetries = 3
+)
+
+// Options configure the server and the database or bucket written to. Bucket selects the v2 API, Database the v1 API.
+type Options struct {
+	// URL is the base URL of the server, e.g. http://localhost:8086.
+	URL string
+
+	// Bucket, Org and Token address the v2 write API.
+	Bucket string
+	Org    string
+	Token  string
+
+	// Database and RetentionPolicy address the v1 write API, optionally authenticated with Username and Password.
+	Database        string
+	RetentionPolicy string
+	Username        string
+	Password        string
+
+	// BatchSize is the maximum number of lines per request.
+	BatchSize int
+	// MaxRetries is the number of retries of a request failing with a 5xx or 429 status or a network error.
+	MaxRetries int
+	// RetryBackoff is the wait before the first retry, doubled for every further retry. Defaults to a second.
+	RetryBackoff time.Duration
+	// Timeout is the timeout of a single request. Defaults to 30 seconds.
+	Timeout time.Duration
+}
+
+// Client writes line protocol to the write endpoint of an InfluxDB server with second precision.
+type Client struct {
+	opts       Options
+	endpoint   string
+	httpClient *http.Client
+
+	// Progress receives a dot per request, if set.
+	Progress io.Writer
+}
+
+// WriteError is returned for a request rejected by the server, e.g. a partial write because of a field type conflict.
+type WriteError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *WriteError) Error() string {
+	return fmt.Sprintf("influxdb responded with %d: %s", e.StatusCode, e.Message)
+}
+
+// retryable returns whether the request may succeed when retried.
+func (e *WriteError) retryable() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+// NewClient validates the options and creates a client.
+func NewClient(opts Options) (*Client, error) {
+	if opts.URL == "" {
+		return nil, errors.New("an InfluxDB URL is required")
+	}
+	base, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid InfluxDB URL %q", opts.URL)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, errors.Errorf("invalid InfluxDB URL %q: expected http or https", opts.URL)
+	}
+
+	query := url.Values{"precision": {"s"}}
+	switch {
+	case opts.Bucket != "" && opts.Database != "":
+		return nil, errors.New("only one of an InfluxDB bucket (v2) and database (v1) can be given")
+	case opts.Bucket != "":
+		base = base.JoinPath("api", "v2", "write")
+		query.Set("bucket", opts.Bucket)
+		if opts.Org != "" {
+			query.Set("org", opts.Org)
+		}
+	case opts.Database != "":
+		base = base.JoinPath("write")
+		query.Set("db", opts.Database)
+		if opts.RetentionPolicy != "" {
+			query.Set("rp", opts.RetentionPolicy)
+		}
+	default:
+		return nil, errors.New("an InfluxDB bucket (v2) or database (v1) is required")
+	}
+	base.RawQuery = query.Encode()
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	return &Client{
+		opts:       opts,
+		endpoint:   base.String(),
+		httpClient: &http.Client{Timeout: opts.Timeout},
+	}, nil
+}
+
+func (c *Client) progress(format string, args ...interface{}) {
+	if c.Progress != nil {
+		_, _ = fmt.Fprintf(c.Progress, format, args...)
+	}
+}
+
+// WriteSeries writes the series in the influxdb line protocol format with the write options.
+func (c *Client) WriteSeries(ctx context.Context, m metrics.Map, opts metrics.WriteOptions) error {
+	var buf bytes.Buffer
+	if err := metrics.WriteSeries(&buf, "influxdb", m, opts); err != nil {
+		return err
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	return c.Write(ctx, strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n"))
+}
+
+// Write posts the lines in batches. A failed batch does not stop the remaining ones, and the error reports how many
+// batches failed along with the first error.
+func (c *Client) Write(ctx context.Context, lines []string) error {
+	c.progress("Writing to InfluxDB")
+	var errs []error
+	batches := 0
+	for start := 0; start < len(lines); start += c.opts.BatchSize {
+		end := min(start+c.opts.BatchSize, len(lines))
+		batches++
+		if err := c.writeBatch(ctx, lines[start:end]); err != nil {
+			errs = append(errs, errors.Wrapf(err, "error writing lines %d to %d", start+1, end))
+		}
+		c.progress(".")
+	}
+	c.progress("done\n")
+	if len(errs) > 0 {
+		return errors.Wrapf(errs[0], "%d of %d InfluxDB batches failed", len(errs), batches)
+	}
+	return nil
+}
+
+// writeBatch posts a batch, retrying with exponential backoff on server errors, throttling and network errors.
+func (c *Client) writeBatch(ctx context.Context, lines []string) error {
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	for _, line := range lines {
+		if _, err := io.WriteString(zw, line+"\n"); err != nil {
+			return errors.Wrap(err, "error compressing lines")
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return errors.Wrap(err, "error compressing lines")
+	}
+
+	backoff := c.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		wait, err := c.post(ctx, body.Bytes())
+		if err == nil {
+			return nil
+		}
+		var writeErr *WriteError
+		if errors.As(err, &writeErr) && !writeErr.retryable() {
+			return err
+		}
+		if attempt >= c.opts.MaxRetries {
+			return errors.Wrapf(err, "giving up after %d attempts", attempt+1)
+		}
+		if wait <= 0 {
+			wait = backoff
+		}
+		backoff *= 2
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// post sends the compressed body once. It returns the wait requested by a Retry-After header along with an error.
+func (c *Client) post(ctx context.Context, body []byte) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, errors.Wrap(err, "error creating request")
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("Content-Encoding", "gzip")
+	switch {
+	case c.opts.Token != "":
+		req.Header.Set("Authorization", "Token "+c.opts.Token)
+	case c.opts.Username != "":
+		req.SetBasicAuth(c.opts.Username, c.opts.Password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, errors.Wrap(err, "error sending request")
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return 0, nil
+	}
+
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		wait = time.Duration(seconds) * time.Second
+	}
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	return wait, &WriteError{StatusCode: resp.StatusCode, Message: errorMessage(raw)}
+}
+
+// errorMessage extracts the message of an error response, which is {"message": ...} in v2 and {"error": ...} in v1.
+func errorMessage(raw []byte) string {
+	var body struct {
+		Message string `json:"message"`
+		Error   string `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &body); err == nil {
+		if body.Message != "" {
+			return body.Message
+		}
+		if body.Error != "" {
+			return body.Error
+		}
+	}
+	return strings.TrimSpace(string(raw))
+}
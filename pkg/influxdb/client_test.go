@@ -0,0 +1,219 @@
+package influxdb
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prom2json"
+	"github.com/stackrox/prometheus-metric-parser/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServer mimics the v1 and v2 write endpoints, answering with the queued responses before accepting writes.
+type fakeServer struct {
+	mu        sync.Mutex
+	requests  []*http.Request
+	bodies    []string
+	responses []func(w http.ResponseWriter)
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path != "/api/v2/write" && r.URL.Path != "/write" {
+		http.NotFound(w, r)
+		return
+	}
+	zr, err := gzip.NewReader(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.requests = append(f.requests, r)
+	f.bodies = append(f.bodies, string(body))
+	if len(f.responses) > 0 {
+		respond := f.responses[0]
+		f.responses = f.responses[1:]
+		respond(w)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func respondWith(status int, body string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, body)
+	}
+}
+
+func testSeries() metrics.Map {
+	gauge := &prom2json.Family{Type: "GAUGE"}
+	m := make(metrics.Map)
+	for _, t := range []string{"Deployment", "Node", "Pod"} {
+		m[metrics.Key{Metric: "objects", Labels: "Type=" + t}] = metrics.Series{
+			Name:   "objects",
+			Labels: metrics.Labels{"Type": t},
+			Value:  3,
+			Family: gauge,
+		}
+	}
+	return m
+}
+
+func TestNewClient(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		opts     Options
+		expected string
+	}{
+		{
+			name:     "v2",
+			opts:     Options{URL: "http://influx:8086/", Bucket: "ci", Org: "stackrox"},
+			expected: "http://influx:8086/api/v2/write?bucket=ci&org=stackrox&precision=s",
+		},
+		{
+			name:     "v1",
+			opts:     Options{URL: "https://influx/prefix", Database: "ci", RetentionPolicy: "week"},
+			expected: "https://influx/prefix/write?db=ci&precision=s&rp=week",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClient(tt.opts)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, c.endpoint)
+		})
+	}
+
+	for name, opts := range map[string]Options{
+		"no url":               {Bucket: "ci"},
+		"no bucket or db":      {URL: "http://influx"},
+		"both bucket and db":   {URL: "http://influx", Bucket: "ci", Database: "ci"},
+		"unsupported protocol": {URL: "udp://influx", Bucket: "ci"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewClient(opts)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestClient_WriteSeries(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		opts  Options
+		path  string
+		check func(t *testing.T, r *http.Request)
+	}{
+		{
+			name: "v2",
+			opts: Options{Bucket: "ci", Org: "stackrox", Token: "secret"},
+			path: "/api/v2/write",
+			check: func(t *testing.T, r *http.Request) {
+				assert.Equal(t, "Token secret", r.Header.Get("Authorization"))
+				assert.Equal(t, "ci", r.URL.Query().Get("bucket"))
+				assert.Equal(t, "stackrox", r.URL.Query().Get("org"))
+			},
+		},
+		{
+			name: "v1",
+			opts: Options{Database: "ci", Username: "user", Password: "pass"},
+			path: "/write",
+			check: func(t *testing.T, r *http.Request) {
+				user, pass, ok := r.BasicAuth()
+				assert.True(t, ok)
+				assert.Equal(t, "user", user)
+				assert.Equal(t, "pass", pass)
+				assert.Equal(t, "ci", r.URL.Query().Get("db"))
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &fakeServer{}
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+
+			tt.opts.URL = ts.URL
+			tt.opts.BatchSize = 2
+			c, err := NewClient(tt.opts)
+			require.NoError(t, err)
+
+			err = c.WriteSeries(context.Background(), testSeries(), metrics.WriteOptions{
+				Labels:    map[string]string{"Test": "ci"},
+				Timestamp: 1700000000,
+			})
+			require.NoError(t, err)
+
+			require.Len(t, server.requests, 2, "lines are batched")
+			for _, r := range server.requests {
+				assert.Equal(t, tt.path, r.URL.Path)
+				assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+				assert.Equal(t, "s", r.URL.Query().Get("precision"))
+				tt.check(t, r)
+			}
+			assert.Equal(t, []string{
+				"objects,Test=ci,Type=Deployment value=3 1700000000\nobjects,Test=ci,Type=Node value=3 1700000000\n",
+				"objects,Test=ci,Type=Pod value=3 1700000000\n",
+			}, server.bodies)
+		})
+	}
+}
+
+func TestClient_Write_retries(t *testing.T) {
+	server := &fakeServer{responses: []func(w http.ResponseWriter){
+		respondWith(http.StatusServiceUnavailable, `{"code":"unavailable","message":"try again"}`),
+		respondWith(http.StatusTooManyRequests, ""),
+	}}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	c, err := NewClient(Options{URL: ts.URL, Bucket: "ci", MaxRetries: 2, RetryBackoff: time.Millisecond})
+	require.NoError(t, err)
+	require.NoError(t, c.Write(context.Background(), []string{"objects value=1 1"}))
+	assert.Len(t, server.requests, 3)
+	assert.Equal(t, server.bodies[0], server.bodies[2], "the same batch is retried")
+
+	server.responses = []func(w http.ResponseWriter){
+		respondWith(http.StatusInternalServerError, `{"error":"timeout"}`),
+		respondWith(http.StatusInternalServerError, `{"error":"timeout"}`),
+		respondWith(http.StatusInternalServerError, `{"error":"timeout"}`),
+	}
+	err = c.Write(context.Background(), []string{"objects value=1 1"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "giving up after 3 attempts")
+	assert.Contains(t, err.Error(), "timeout")
+}
+
+func TestClient_Write_partialWrite(t *testing.T) {
+	server := &fakeServer{responses: []func(w http.ResponseWriter){
+		respondWith(http.StatusBadRequest, `{"code":"invalid","message":"partial write: field type conflict: input field \"value\" on measurement \"objects\" is type string, already exists as type float dropped=1"}`),
+	}}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	c, err := NewClient(Options{URL: ts.URL, Bucket: "ci", BatchSize: 1, MaxRetries: 3, RetryBackoff: time.Millisecond})
+	require.NoError(t, err)
+	err = c.Write(context.Background(), []string{"objects value=1 1", "objects value=2 2"})
+	require.Error(t, err)
+
+	assert.Len(t, server.requests, 2, "client errors are not retried and the remaining batches are written")
+	assert.True(t, strings.HasPrefix(err.Error(), "1 of 2 InfluxDB batches failed: error writing lines 1 to 1"), err.Error())
+	var writeErr *WriteError
+	require.ErrorAs(t, err, &writeErr)
+	assert.Equal(t, http.StatusBadRequest, writeErr.StatusCode)
+	assert.Contains(t, writeErr.Message, "partial write: field type conflict")
+}
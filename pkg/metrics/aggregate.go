@@ -0,0 +1,276 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// AggregationOp is the operator used to aggregate the values of counters and gauges.
+type AggregationOp string
+
+const (
+	AggregateSum   AggregationOp = "sum"
+	AggregateAvg   AggregationOp = "avg"
+	AggregateMin   AggregationOp = "min"
+	AggregateMax   AggregationOp = "max"
+	AggregateCount AggregationOp = "count"
+)
+
+// Validate returns an error if the operator is unknown.
+func (op AggregationOp) Validate() error {
+	switch op {
+	case AggregateSum, AggregateAvg, AggregateMin, AggregateMax, AggregateCount:
+		return nil
+	default:
+		return errors.Errorf("unknown aggregation operator %q (expected sum, avg, min, max or count)", op)
+	}
+}
+
+// Aggregation merges the series of a metric into one series per group like a Prometheus aggregation operator, e.g.
+// sum by (Type) or sum without (Op). Without by or without all series of a metric are merged into one.
+type Aggregation struct {
+	Op AggregationOp
+	// Without drops the Labels from the series instead of keeping only them.
+	Without bool
+	Labels  []string
+}
+
+// ParseAggregation parses an aggregation such as "sum by (Type)", "max without (Op, Error)" or "avg".
+func ParseAggregation(s string) (*Aggregation, error) {
+	fields := strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ", ",", " , ").Replace(s))
+	if len(fields) == 0 {
+		return nil, errors.New("an aggregation operator is required")
+	}
+	a := &Aggregation{Op: AggregationOp(strings.ToLower(fields[0]))}
+	if err := a.Op.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid aggregation %q", s)
+	}
+	rest := fields[1:]
+	if len(rest) == 0 {
+		return a, nil
+	}
+	switch strings.ToLower(rest[0]) {
+	case "by":
+	case "without":
+		a.Without = true
+	default:
+		return nil, errors.Errorf("invalid aggregation %q: expected by or without after %s", s, a.Op)
+	}
+	rest = rest[1:]
+	if len(rest) < 2 || rest[0] != "(" || rest[len(rest)-1] != ")" {
+		return nil, errors.Errorf("invalid aggregation %q: expected a parenthesized list of labels", s)
+	}
+	for i, field := range rest[1 : len(rest)-1] {
+		if i%2 == 1 {
+			if field != "," {
+				return nil, errors.Errorf("invalid aggregation %q: expected , between labels", s)
+			}
+			continue
+		}
+		if strings.ContainsAny(field, "(),") {
+			return nil, errors.Errorf("invalid aggregation %q: expected label name", s)
+		}
+		a.Labels = append(a.Labels, field)
+	}
+	return a, nil
+}
+
+func (a *Aggregation) String() string {
+	if a.Without {
+		return string(a.Op) + " without (" + strings.Join(a.Labels, ", ") + ")"
+	}
+	if len(a.Labels) == 0 {
+		return string(a.Op)
+	}
+	return string(a.Op) + " by (" + strings.Join(a.Labels, ", ") + ")"
+}
+
+// group returns the labels of the group the series with the given labels belongs to.
+func (a *Aggregation) group(labels Labels) Labels {
+	grouped := make(Labels)
+	if a.Without {
+		for name, value := range labels {
+			grouped[name] = value
+		}
+		for _, name := range a.Labels {
+			delete(grouped, name)
+		}
+		return grouped
+	}
+	for _, name := range a.Labels {
+		if value, ok := labels[name]; ok {
+			grouped[name] = value
+		}
+	}
+	return grouped
+}
+
+// Apply merges the series of m per metric and group. Counters and gauges are aggregated with the operator, while
+// histograms and summaries are always merged by adding up their sums, counts and buckets, so the mean and the
+// histogram quantiles of the group stay correct. The minimum histogram count and quantiles of opts are applied to the
+// merged series. Summary quantiles cannot be merged and are dropped.
+//
+// The series of m are expected to be converted without quantiles or minimum histogram count.
+func (a *Aggregation) Apply(m Map, opts Options) Map {
+	groups := make(Map)
+	members := make(map[Key]int)
+	for _, k := range m.SortedKeys() {
+		s := m[k]
+		if s.Family == nil {
+			continue
+		}
+		if _, isQuantile := s.Labels[QuantileLabel]; isQuantile && s.Family.Type == "SUMMARY" {
+			continue
+		}
+		labels := a.group(s.Labels)
+		gk := Key{Metric: k.Metric, Labels: labels.String()}
+		n := members[gk]
+		members[gk] = n + 1
+
+		g, ok := groups[gk]
+		if !ok {
+			s.Labels = labels
+			if s.Family.Type == "COUNTER" || s.Family.Type == "GAUGE" {
+				s.Value = a.Op.first(s.Value)
+			}
+			s.Buckets = addBuckets(nil, s.Buckets, 1)
+			groups[gk] = s
+			continue
+		}
+		switch s.Family.Type {
+		case "HISTOGRAM", "SUMMARY":
+			g.Sum += s.Sum
+			g.Count += s.Count
+			g.Buckets = addBuckets(g.Buckets, s.Buckets, 1)
+		default:
+			g.Value = a.Op.merge(g.Value, s.Value, n)
+		}
+		groups[gk] = g
+	}
+
+	aggregated := make(Map)
+	for k, s := range groups {
+		switch s.Family.Type {
+		case "HISTOGRAM", "SUMMARY":
+			if s.Count < float64(opts.MinHistogramCount) {
+				continue
+			}
+			s.Value = s.Sum / s.Count
+			aggregated[k] = s
+
+			if s.Family.Type != "HISTOGRAM" {
+				continue
+			}
+			for _, q := range opts.Quantiles {
+				labels := withQuantile(s.Labels, FormatQuantile(q))
+				aggregated[Key{Metric: k.Metric, Labels: labels.String()}] = Series{
+					Name:   s.Name,
+					Labels: labels,
+					Value:  HistogramQuantile(q, s.Buckets, s.Count),
+					Sum:    s.Sum,
+					Count:  s.Count,
+					Family: s.Family,
+				}
+			}
+		default:
+			aggregated[k] = s
+		}
+	}
+	return aggregated
+}
+
+// SplitSelectors splits the selectors of the options for aggregating. Before aggregating, the series are selected by
+// the selectors without their quantile matchers, as the quantiles of histograms are only calculated after aggregating,
+// and excluded by the selectors without quantile matchers. After aggregating, each selector is matched whole against
+// the aggregated series, except for the matchers of labels aggregated away, so a quantile matcher only applies together
+// with the other labels of its selector. Excluding quantiles by labels which are aggregated away is ambiguous and an
+// error.
+func (a *Aggregation) SplitSelectors(opts Options) (before, after Options, err error) {
+	before.TrimPrefix = opts.TrimPrefix
+	for _, s := range opts.Select {
+		before.Select = append(before.Select, withoutMatcher(s, QuantileLabel))
+		after.Select = append(after.Select, a.kept(s))
+	}
+	for _, s := range opts.Exclude {
+		if !hasMatcher(s, QuantileLabel) {
+			before.Exclude = append(before.Exclude, s)
+			continue
+		}
+		kept := a.kept(s)
+		if len(kept.Matchers) != len(s.Matchers) {
+			return Options{}, Options{}, errors.Errorf("cannot exclude %s after %s: it matches labels which are aggregated away", s, a)
+		}
+		after.Exclude = append(after.Exclude, kept)
+	}
+	return before, after, nil
+}
+
+// keeps returns whether the aggregated series keep the label.
+func (a *Aggregation) keeps(name string) bool {
+	if name == nameLabel || name == QuantileLabel {
+		return true
+	}
+	for _, l := range a.Labels {
+		if l == name {
+			return !a.Without
+		}
+	}
+	return a.Without
+}
+
+// kept returns the selector with only the matchers of labels the aggregated series keep.
+func (a *Aggregation) kept(s *Selector) *Selector {
+	kept := &Selector{}
+	for _, m := range s.Matchers {
+		if a.keeps(m.Name) {
+			kept.Matchers = append(kept.Matchers, m)
+		}
+	}
+	return kept
+}
+
+// withoutMatcher returns the selector without the matchers of the label.
+func withoutMatcher(s *Selector, name string) *Selector {
+	other := &Selector{}
+	for _, m := range s.Matchers {
+		if m.Name != name {
+			other.Matchers = append(other.Matchers, m)
+		}
+	}
+	return other
+}
+
+func hasMatcher(s *Selector, name string) bool {
+	for _, m := range s.Matchers {
+		if m.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// first returns the aggregated value of a group with a single value v.
+func (op AggregationOp) first(v float64) float64 {
+	if op == AggregateCount {
+		return 1
+	}
+	return v
+}
+
+// merge returns the aggregated value of a group after adding v to the n values aggregated into acc.
+func (op AggregationOp) merge(acc, v float64, n int) float64 {
+	switch op {
+	case AggregateAvg:
+		return acc + (v-acc)/float64(n+1)
+	case AggregateMin:
+		return math.Min(acc, v)
+	case AggregateMax:
+		return math.Max(acc, v)
+	case AggregateCount:
+		return acc + 1
+	default:
+		return acc + v
+	}
+}
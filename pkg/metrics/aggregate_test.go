@@ -0,0 +1,222 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const aggregateSample = `# TYPE rox_central_postgres_op_duration histogram
+rox_central_postgres_op_duration_bucket{Op="Get",Type="Pod",le="1"} 10
+rox_central_postgres_op_duration_bucket{Op="Get",Type="Pod",le="2"} 10
+rox_central_postgres_op_duration_bucket{Op="Get",Type="Pod",le="+Inf"} 10
+rox_central_postgres_op_duration_sum{Op="Get",Type="Pod"} 5
+rox_central_postgres_op_duration_count{Op="Get",Type="Pod"} 10
+rox_central_postgres_op_duration_bucket{Op="Upsert",Type="Pod",le="1"} 0
+rox_central_postgres_op_duration_bucket{Op="Upsert",Type="Pod",le="2"} 30
+rox_central_postgres_op_duration_bucket{Op="Upsert",Type="Pod",le="+Inf"} 30
+rox_central_postgres_op_duration_sum{Op="Upsert",Type="Pod"} 45
+rox_central_postgres_op_duration_count{Op="Upsert",Type="Pod"} 30
+rox_central_postgres_op_duration_bucket{Op="Get",Type="Node",le="1"} 4
+rox_central_postgres_op_duration_bucket{Op="Get",Type="Node",le="2"} 4
+rox_central_postgres_op_duration_bucket{Op="Get",Type="Node",le="+Inf"} 4
+rox_central_postgres_op_duration_sum{Op="Get",Type="Node"} 2
+rox_central_postgres_op_duration_count{Op="Get",Type="Node"} 4
+# TYPE rox_central_requests_total counter
+rox_central_requests_total{Op="Get",Type="Pod"} 100
+rox_central_requests_total{Op="Upsert",Type="Pod"} 50
+rox_central_requests_total{Op="Get",Type="Node"} 10
+# TYPE go_gc_duration_seconds summary
+go_gc_duration_seconds{Pool="a",quantile="0.5"} 1
+go_gc_duration_seconds_sum{Pool="a"} 10
+go_gc_duration_seconds_count{Pool="a"} 10
+go_gc_duration_seconds{Pool="b",quantile="0.5"} 3
+go_gc_duration_seconds_sum{Pool="b"} 30
+go_gc_duration_seconds_count{Pool="b"} 10
+`
+
+func TestParseAggregation(t *testing.T) {
+	for _, tt := range []struct {
+		aggregation string
+		expected    string
+	}{
+		{aggregation: "sum by (Type)", expected: "sum by (Type)"},
+		{aggregation: "MAX by(Type,Op,)", expected: "max by (Type, Op)"},
+		{aggregation: " avg without ( Op ) ", expected: "avg without (Op)"},
+		{aggregation: "count", expected: "count"},
+	} {
+		t.Run(tt.aggregation, func(t *testing.T) {
+			a, err := ParseAggregation(tt.aggregation)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, a.String())
+		})
+	}
+
+	for _, invalid := range []string{"", "median by (Type)", "sum over (Type)", "sum by Type", "sum by (Type", "sum by (Type Op)", "sum by (,Type)", "sum (Type)"} {
+		t.Run(invalid, func(t *testing.T) {
+			_, err := ParseAggregation(invalid)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestToSeries_aggregate(t *testing.T) {
+	families, _, err := Parse(strings.NewReader(aggregateSample), false)
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		aggregation string
+		expected    map[Key]float64
+	}{
+		{
+			aggregation: "sum by (Type)",
+			expected: map[Key]float64{
+				{Metric: "postgres_op_duration", Labels: "Type=Node"}:              0.5,
+				{Metric: "postgres_op_duration", Labels: "Type=Node quantile=0.5"}: 0.5,
+				{Metric: "postgres_op_duration", Labels: "Type=Pod"}:               50.0 / 40,
+				{Metric: "postgres_op_duration", Labels: "Type=Pod quantile=0.5"}:  4.0 / 3,
+				{Metric: "requests_total", Labels: "Type=Node"}:                    10,
+				{Metric: "requests_total", Labels: "Type=Pod"}:                     150,
+				{Metric: "go_gc_duration_seconds", Labels: ""}:                     2,
+			},
+		},
+		{
+			aggregation: "max without (Op)",
+			expected: map[Key]float64{
+				{Metric: "postgres_op_duration", Labels: "Type=Node"}:              0.5,
+				{Metric: "postgres_op_duration", Labels: "Type=Node quantile=0.5"}: 0.5,
+				{Metric: "postgres_op_duration", Labels: "Type=Pod"}:               50.0 / 40,
+				{Metric: "postgres_op_duration", Labels: "Type=Pod quantile=0.5"}:  4.0 / 3,
+				{Metric: "requests_total", Labels: "Type=Node"}:                    10,
+				{Metric: "requests_total", Labels: "Type=Pod"}:                     100,
+				{Metric: "go_gc_duration_seconds", Labels: "Pool=a"}:               1,
+				{Metric: "go_gc_duration_seconds", Labels: "Pool=b"}:               3,
+			},
+		},
+		{
+			aggregation: "avg",
+			expected: map[Key]float64{
+				{Metric: "postgres_op_duration", Labels: ""}:             52.0 / 44,
+				{Metric: "postgres_op_duration", Labels: "quantile=0.5"}: 19.0 / 15,
+				{Metric: "requests_total", Labels: ""}:                   160.0 / 3,
+				{Metric: "go_gc_duration_seconds", Labels: ""}:           2,
+			},
+		},
+	} {
+		t.Run(tt.aggregation, func(t *testing.T) {
+			a, err := ParseAggregation(tt.aggregation)
+			require.NoError(t, err)
+			m, err := ToSeries(families, Options{TrimPrefix: "rox_central_", Quantiles: []float64{0.5}, Aggregate: a})
+			require.NoError(t, err)
+
+			actual := make(map[Key]float64)
+			for k, s := range m {
+				actual[k] = s.Value
+			}
+			assert.InDeltaMapValues(t, tt.expected, actual, 1e-9)
+		})
+	}
+}
+
+func TestToSeries_aggregateSelectAndMinCount(t *testing.T) {
+	families, _, err := Parse(strings.NewReader(aggregateSample), false)
+	require.NoError(t, err)
+	a, err := ParseAggregation("sum by (Type)")
+	require.NoError(t, err)
+	selector, err := ParseSelector(`rox_central_postgres_op_duration{Op="Get"}`)
+	require.NoError(t, err)
+
+	m, err := ToSeries(families, Options{
+		MinHistogramCount: 5,
+		TrimPrefix:        "rox_central_",
+		Select:            []*Selector{selector},
+		Aggregate:         a,
+	})
+	require.NoError(t, err)
+
+	require.Len(t, m, 1, "the selectors apply before and the minimum count after aggregating")
+	s := m[Key{Metric: "postgres_op_duration", Labels: "Type=Pod"}]
+	assert.Equal(t, 10.0, s.Count)
+	assert.Equal(t, []Bucket{{1, 10}, {2, 10}, {math.Inf(1), 10}}, s.Buckets)
+}
+
+func TestToSeries_aggregateQuantileSelectors(t *testing.T) {
+	families, _, err := Parse(strings.NewReader(aggregateSample), false)
+	require.NoError(t, err)
+	a, err := ParseAggregation("sum by (Type)")
+	require.NoError(t, err)
+	selectors := func(selectors ...string) []*Selector {
+		var parsed []*Selector
+		for _, s := range selectors {
+			selector, err := ParseSelector(s)
+			require.NoError(t, err)
+			parsed = append(parsed, selector)
+		}
+		return parsed
+	}
+	keys := func(m Map) []string {
+		var keys []string
+		for _, k := range m.SortedKeys() {
+			keys = append(keys, k.Metric+" "+k.Labels)
+		}
+		return keys
+	}
+	quantiles := []float64{0.5, 0.99}
+
+	for _, tt := range []struct {
+		name     string
+		include  []*Selector
+		exclude  []*Selector
+		expected []string
+	}{
+		{
+			name:     "select quantile",
+			include:  selectors(`rox_central_postgres_op_duration{Op="Get",quantile="0.99"}`),
+			expected: []string{"postgres_op_duration Type=Node quantile=0.99", "postgres_op_duration Type=Pod quantile=0.99"},
+		},
+		{
+			name:     "exclude quantile",
+			include:  selectors(`rox_central_postgres_op_duration{Type="Node"}`),
+			exclude:  selectors(`{quantile="0.5"}`),
+			expected: []string{"postgres_op_duration Type=Node", "postgres_op_duration Type=Node quantile=0.99"},
+		},
+		{
+			name: "select quantile per group",
+			include: selectors(`rox_central_postgres_op_duration{Type="Pod",quantile="0.5"}`,
+				`rox_central_postgres_op_duration{Type="Node",quantile="0.99"}`),
+			expected: []string{"postgres_op_duration Type=Node quantile=0.99", "postgres_op_duration Type=Pod quantile=0.5"},
+		},
+		{
+			name:    "exclude quantile of a group",
+			include: selectors(`rox_central_postgres_op_duration`),
+			exclude: selectors(`{Type="Pod",quantile="0.99"}`),
+			expected: []string{"postgres_op_duration Type=Node", "postgres_op_duration Type=Node quantile=0.5",
+				"postgres_op_duration Type=Node quantile=0.99", "postgres_op_duration Type=Pod", "postgres_op_duration Type=Pod quantile=0.5"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			aggregated, err := ToSeries(families, Options{TrimPrefix: "rox_central_", Quantiles: quantiles, Select: tt.include, Exclude: tt.exclude, Aggregate: a})
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, keys(aggregated))
+
+			plain, err := ToSeries(families, Options{TrimPrefix: "rox_central_", Quantiles: quantiles, Select: tt.include, Exclude: tt.exclude})
+			require.NoError(t, err)
+			assert.Equal(t, quantilesOf(aggregated), quantilesOf(plain), "the same quantiles are selected without aggregation")
+		})
+	}
+
+	_, err = ToSeries(families, Options{Quantiles: quantiles, Exclude: selectors(`{Op="Get",quantile="0.99"}`), Aggregate: a})
+	assert.ErrorContains(t, err, "labels which are aggregated away")
+}
+
+// quantilesOf returns the quantile labels of the series, "" for series without.
+func quantilesOf(m Map) map[string]bool {
+	quantiles := make(map[string]bool)
+	for _, s := range m {
+		quantiles[s.Labels[QuantileLabel]] = true
+	}
+	return quantiles
+}
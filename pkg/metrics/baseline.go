@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+)
+
+// Baseline is the spread of the values of a series across multiple baseline runs.
+type Baseline struct {
+	// Runs is the number of baseline runs the series is present in.
+	Runs   int
+	Mean   float64
+	StdDev float64
+	Min    float64
+	Max    float64
+}
+
+func (b Baseline) String() string {
+	return fmt.Sprintf("±%0.2f [%0.2f, %0.2f] n=%d", b.StdDev, b.Min, b.Max, b.Runs)
+}
+
+// ZScore returns the number of standard deviations value is away from the mean. It is undefined if the baseline
+// values have no spread.
+func (b Baseline) ZScore(value float64) (float64, bool) {
+	if b.StdDev == 0 {
+		return 0, false
+	}
+	return (value - b.Mean) / b.StdDev, true
+}
+
+// Contains returns whether value is within the range of the baseline values.
+func (b Baseline) Contains(value float64) bool {
+	return value >= b.Min && value <= b.Max
+}
+
+// MergeBaselines merges the series of multiple baseline runs into one map. The value, sum and count of each series
+// as well as the histogram bucket counts are the means across the runs the series is present in, and its Baseline
+// holds the spread of the values. A single run is returned as is.
+func MergeBaselines(runs []Map) Map {
+	if len(runs) == 1 {
+		return runs[0]
+	}
+
+	values := make(map[Key][]Series)
+	for _, run := range runs {
+		for k, s := range run {
+			values[k] = append(values[k], s)
+		}
+	}
+
+	merged := make(Map, len(values))
+	for k, series := range values {
+		m := Series{
+			Name:   series[0].Name,
+			Labels: series[0].Labels,
+			Family: series[0].Family,
+		}
+		baseline := &Baseline{
+			Runs: len(series),
+			Min:  math.Inf(1),
+			Max:  math.Inf(-1),
+		}
+		n := float64(len(series))
+		for _, s := range series {
+			m.Value += s.Value / n
+			m.Sum += s.Sum / n
+			m.Count += s.Count / n
+			m.Buckets = addBuckets(m.Buckets, s.Buckets, 1/n)
+			baseline.Min = math.Min(baseline.Min, s.Value)
+			baseline.Max = math.Max(baseline.Max, s.Value)
+		}
+		if baseline.Min == baseline.Max {
+			// Avoid a rounding error spread for identical values.
+			m.Value = baseline.Min
+		}
+		baseline.Mean = m.Value
+		if baseline.Min != baseline.Max {
+			var squares float64
+			for _, s := range series {
+				squares += (s.Value - baseline.Mean) * (s.Value - baseline.Mean)
+			}
+			baseline.StdDev = math.Sqrt(squares / (n - 1))
+		}
+		m.Baseline = baseline
+		merged[k] = m
+	}
+	return merged
+}
+
+// addBuckets adds the counts of the buckets b multiplied by weight to those of a with the same upper bound.
+// Buckets only present in b are ignored, as all runs of a histogram are expected to have the same buckets.
+func addBuckets(a, b []Bucket, weight float64) []Bucket {
+	if a == nil {
+		if len(b) == 0 {
+			return nil
+		}
+		a = make([]Bucket, len(b))
+		for i := range b {
+			a[i].UpperBound = b[i].UpperBound
+		}
+	}
+	j := 0
+	for i := range a {
+		for j < len(b) && b[j].UpperBound < a[i].UpperBound {
+			j++
+		}
+		if j < len(b) && b[j].UpperBound == a[i].UpperBound {
+			a[i].Count += b[j].Count * weight
+		}
+	}
+	return a
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeBaselines(t *testing.T) {
+	k := Key{Metric: "events", Labels: "Type=Pod"}
+	constant := Key{Metric: "constant"}
+	runs := []Map{
+		{k: {Name: "events", Value: 10, Buckets: []Bucket{{UpperBound: 1, Count: 2}}}, constant: {Value: 0.1}},
+		{k: {Name: "events", Value: 12, Buckets: []Bucket{{UpperBound: 1, Count: 4}}}, constant: {Value: 0.1}},
+		{k: {Name: "events", Value: 14, Buckets: []Bucket{{UpperBound: 1, Count: 6}}}, constant: {Value: 0.1}},
+		{constant: {Value: 0.1}},
+	}
+
+	merged := MergeBaselines(runs)
+
+	require.Contains(t, merged, k)
+	assert.InDelta(t, 12, merged[k].Value, 1e-9)
+	assert.Equal(t, []Bucket{{UpperBound: 1, Count: 4}}, merged[k].Buckets)
+	require.NotNil(t, merged[k].Baseline)
+	assert.Equal(t, 3, merged[k].Baseline.Runs)
+	assert.InDelta(t, 2, merged[k].Baseline.StdDev, 1e-9)
+	assert.Equal(t, 10.0, merged[k].Baseline.Min)
+	assert.Equal(t, 14.0, merged[k].Baseline.Max)
+
+	assert.Equal(t, 0.1, merged[constant].Value, "identical values have no rounding error")
+	assert.Zero(t, merged[constant].Baseline.StdDev)
+
+	assert.Equal(t, runs[0], MergeBaselines(runs[:1]), "a single run is returned as is")
+}
+
+func TestRule_Evaluate_baseline(t *testing.T) {
+	k := Key{Metric: "sensor_event_duration"}
+	old := Series{Value: 12, Baseline: &Baseline{Runs: 3, Mean: 12, StdDev: 2, Min: 10, Max: 14}}
+
+	rule := &Rule{WarnZ: 2, ErrorZ: 3, Direction: DirectionAuto}
+	delta := rule.Evaluate(k, old, Series{Value: 17})
+	assert.True(t, delta.HasZScore)
+	assert.InDelta(t, 2.5, delta.ZScore, 1e-9)
+	assert.True(t, delta.IsWarn)
+	assert.False(t, delta.IsError)
+
+	delta = rule.Evaluate(k, old, Series{Value: 4})
+	assert.True(t, delta.IsImprovement, "a lower latency is an improvement")
+
+	rule = &Rule{OutsideRange: StatusError, Direction: DirectionBoth}
+	delta = rule.Evaluate(k, old, Series{Value: 14})
+	assert.False(t, delta.OutsideRange)
+	assert.False(t, delta.IsError)
+	delta = rule.Evaluate(k, old, Series{Value: 9})
+	assert.True(t, delta.OutsideRange)
+	assert.True(t, delta.IsError)
+
+	delta = rule.Evaluate(k, Series{Value: 12, Baseline: &Baseline{Runs: 3, Mean: 12, Min: 12, Max: 12}}, Series{Value: 13})
+	assert.False(t, delta.HasZScore, "the z-score is undefined without spread")
+	assert.True(t, delta.IsError)
+}
+
+func TestWriteComparison_baseline(t *testing.T) {
+	k := Key{Metric: "events", Labels: "Type=Pod"}
+	oldMap := MergeBaselines([]Map{
+		{k: {Name: "events", Value: 10}},
+		{k: {Name: "events", Value: 14}},
+	})
+	newMap := Map{k: {Name: "events", Value: 15}}
+
+	var buff bytes.Buffer
+	require.NoError(t, WriteComparison(&buff, "csv", Compare(oldMap, newMap, testCompareOptions(t, 0, 0))))
+	assert.Equal(t, "metric,labels,old,new,change,stddev,min,max,zscore\n"+
+		"events,Type=Pod,12,15,25,2.8284271247461903,10,14,1.0606601717798212\n", buff.String())
+
+	buff.Reset()
+	require.NoError(t, WriteComparison(&buff, "plain", Compare(oldMap, newMap, testCompareOptions(t, 0, 0))))
+	assert.Equal(t, "events Type=Pod (old: 12.00 ±2.83 [10.00, 14.00] n=2, new 15.00): change: 25.0000%, z: +1.06\n", buff.String())
+}
@@ -0,0 +1,346 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Status summarizes a delta. Deltas are reported by the most severe status which applies.
+type Status string
+
+const (
+	StatusError            Status = "error"
+	StatusWarn             Status = "warn"
+	StatusImprovement      Status = "improvement"
+	StatusInsufficientData Status = "insufficient-data"
+	StatusOK               Status = "ok"
+)
+
+// Delta is the change of a series between the old and new metrics.
+type Delta struct {
+	// PercentChange is relative to the old value, and 0 if the old value is 0.
+	PercentChange float64
+	AbsChange     float64
+	Direction     Direction
+	// ZScore is the number of standard deviations the new value is away from the mean of a multi-run baseline.
+	// It is only set if HasZScore, i.e. the baseline values have a spread.
+	ZScore    float64
+	HasZScore bool
+	// OutsideRange is set if the new value is outside the range of the values of a multi-run baseline.
+	OutsideRange bool
+	// Distribution is the result of the distribution test of histograms, if enabled.
+	Distribution  *DistributionResult
+	IsWarn        bool
+	IsError       bool
+	IsImprovement bool
+	// InsufficientData is set when a histogram or summary has too few observations for a meaningful comparison.
+	InsufficientData bool
+	Rule             *Rule
+}
+
+// FiredRule returns the name of the threshold rule which flagged the delta as warning or error,
+// or an empty string if the delta was not flagged or only by the default thresholds.
+func (d Delta) FiredRule() string {
+	if (!d.IsWarn && !d.IsError) || d.Rule == nil || d.Rule.isDefault {
+		return ""
+	}
+	return d.Rule.String()
+}
+
+// Status summarizes the delta as one of error, warn, improvement, insufficient-data or ok.
+func (d Delta) Status() Status {
+	switch {
+	case d.IsError:
+		return StatusError
+	case d.IsWarn:
+		return StatusWarn
+	case d.IsImprovement:
+		return StatusImprovement
+	case d.InsufficientData:
+		return StatusInsufficientData
+	default:
+		return StatusOK
+	}
+}
+
+// statisticsSuffix returns the z-score and distribution test result of the delta for the reports,
+// or an empty string if it has neither.
+func (d Delta) statisticsSuffix() string {
+	var suffix string
+	if d.HasZScore {
+		suffix += fmt.Sprintf(", z: %+0.2f", d.ZScore)
+	}
+	if d.Distribution != nil {
+		suffix += ", " + d.Distribution.String()
+	}
+	return suffix
+}
+
+// CompareOptions control how series are compared and when a comparison fails.
+type CompareOptions struct {
+	Thresholds Thresholds
+	// FailOnAdded fails the comparison when series are only present in the new metrics.
+	FailOnAdded bool
+	// FailOnRemoved fails the comparison when series are only present in the old metrics.
+	FailOnRemoved bool
+}
+
+// Comparison is the result of comparing two metric maps.
+type Comparison struct {
+	Old, New Map
+	// Keys are the sorted keys of the series present in both maps.
+	Keys []Key
+	// Added are the sorted keys of the series only present in the new map.
+	Added []Key
+	// Removed are the sorted keys of the series only present in the old map.
+	Removed []Key
+	Deltas  map[Key]Delta
+	Options CompareOptions
+}
+
+// Compare calculates the deltas of all series present in both maps according to the thresholds.
+func Compare(oldMap, newMap Map, opts CompareOptions) *Comparison {
+	c := &Comparison{
+		Old:     oldMap,
+		New:     newMap,
+		Deltas:  make(map[Key]Delta),
+		Options: opts,
+	}
+	for k := range oldMap {
+		if _, ok := newMap[k]; ok {
+			c.Keys = append(c.Keys, k)
+		} else {
+			c.Removed = append(c.Removed, k)
+		}
+	}
+	for k := range newMap {
+		if _, ok := oldMap[k]; !ok {
+			c.Added = append(c.Added, k)
+		}
+	}
+	SortKeys(c.Keys)
+	SortKeys(c.Added)
+	SortKeys(c.Removed)
+
+	for _, k := range c.Keys {
+		rule := opts.Thresholds.RuleFor(k, newMap[k])
+		c.Deltas[k] = rule.Evaluate(k, oldMap[k], newMap[k])
+	}
+	return c
+}
+
+// Failed returns whether any delta is an error, or series were added or removed and the options fail on these.
+func (c *Comparison) Failed() bool {
+	if c.Options.FailOnAdded && len(c.Added) > 0 {
+		return true
+	}
+	if c.Options.FailOnRemoved && len(c.Removed) > 0 {
+		return true
+	}
+	for _, v := range c.Deltas {
+		if v.IsError {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteComparison writes the comparison in the given format, one of plain, csv, html-table, json, jsonl, markdown
+// or junit.
+func WriteComparison(w io.Writer, format string, c *Comparison) error {
+	switch format {
+	case "plain":
+		return c.writePlain(w)
+	case "csv":
+		return c.writeCSV(w)
+	case "html-table":
+		return c.writeHTMLTable(w)
+	case "json":
+		return c.writeJSON(w)
+	case "jsonl":
+		return c.writeJSONLines(w)
+	case "markdown":
+		return c.writeMarkdown(w)
+	case "junit":
+		return c.writeJUnit(w)
+	default:
+		return errors.Errorf("unknown compare output format %q", format)
+	}
+}
+
+func (c *Comparison) writePlain(w io.Writer) error {
+	ew := &errWriter{w: w}
+	for _, k := range c.Keys {
+		delta := c.Deltas[k]
+		if delta.InsufficientData {
+			ew.printf("%s %s (old: %s, new %s): insufficient data\n", k.Metric, k.Labels, c.Old[k].String(), c.New[k].String())
+		} else if c.Old[k].Value != 0 {
+			prefixParts := make([]string, 0)
+			if delta.IsWarn || delta.IsError {
+				prefixParts = append(prefixParts, "1")
+			}
+			if delta.IsError {
+				prefixParts = append(prefixParts, "31", "4")
+			}
+			if delta.IsImprovement {
+				prefixParts = append(prefixParts, "32")
+			}
+			decorationPrefix := ""
+			if len(prefixParts) > 0 {
+				decorationPrefix = "\033[" + strings.Join(prefixParts, ";") + "m"
+			}
+			decorationSuffix := ""
+			if decorationPrefix != "" {
+				decorationSuffix = "\033[0m"
+			}
+			ruleSuffix := ""
+			if rule := delta.FiredRule(); rule != "" {
+				ruleSuffix = fmt.Sprintf(" [rule: %s]", rule)
+			}
+			ew.printf("%s%s %s (old: %s, new %s): change: %0.4f%%%s%s%s\n",
+				decorationPrefix, k.Metric, k.Labels, c.Old[k].String(), c.New[k].String(), delta.PercentChange, delta.statisticsSuffix(), ruleSuffix, decorationSuffix)
+		} else {
+			ew.printf("%s %s (old: %s, new %s)\n", k.Metric, k.Labels, c.Old[k].String(), c.New[k].String())
+		}
+	}
+
+	if len(c.Added) > 0 {
+		ew.printf("\nAdded series (%d):\n", len(c.Added))
+		for _, k := range c.Added {
+			ew.printf("%s %s (new %s)\n", k.Metric, k.Labels, c.New[k].String())
+		}
+	}
+	if len(c.Removed) > 0 {
+		ew.printf("\nRemoved series (%d):\n", len(c.Removed))
+		for _, k := range c.Removed {
+			ew.printf("%s %s (old: %s)\n", k.Metric, k.Labels, c.Old[k].String())
+		}
+	}
+	return ew.err
+}
+
+// hasBaseline returns whether the old series were merged from multiple runs.
+func (c *Comparison) hasBaseline() bool {
+	for _, s := range c.Old {
+		return s.Baseline != nil
+	}
+	return false
+}
+
+// hasDistributions returns whether any delta has a distribution test result.
+func (c *Comparison) hasDistributions() bool {
+	for _, d := range c.Deltas {
+		if d.Distribution != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Comparison) writeCSV(w io.Writer) error {
+	ew := &errWriter{w: w}
+	hasBaseline, hasDistributions := c.hasBaseline(), c.hasDistributions()
+	header := "metric,labels,old,new,change"
+	if hasBaseline {
+		header += ",stddev,min,max,zscore"
+	}
+	if hasDistributions {
+		header += ",test,statistic,pvalue"
+	}
+	ew.printf("%s\n", header)
+	for _, k := range c.Keys {
+		newSeries := c.New[k]
+		oldSeries := c.Old[k]
+		delta := c.Deltas[k]
+		extraColumns := ""
+		if hasBaseline {
+			if b := oldSeries.Baseline; b != nil {
+				extraColumns += fmt.Sprintf(",%g,%g,%g,", b.StdDev, b.Min, b.Max)
+				if delta.HasZScore {
+					extraColumns += fmt.Sprintf("%g", delta.ZScore)
+				}
+			} else {
+				extraColumns += ",,,,"
+			}
+		}
+		if hasDistributions {
+			if d := delta.Distribution; d != nil {
+				extraColumns += fmt.Sprintf(",%s,%g,%g", d.Test, d.Statistic, d.PValue)
+			} else {
+				extraColumns += ",,,"
+			}
+		}
+		if delta.InsufficientData {
+			ew.printf("%s,%s,%g,%g,insufficient data%s\n", k.Metric, k.Labels, oldSeries.Value, newSeries.Value, extraColumns)
+		} else if oldSeries.Value != 0 {
+			ew.printf("%s,%s,%g,%g,%g%s\n", k.Metric, k.Labels, oldSeries.Value, newSeries.Value, delta.PercentChange, extraColumns)
+		} else {
+			ew.printf("%s,%s,%g,%g,N/A%s\n", k.Metric, k.Labels, oldSeries.Value, newSeries.Value, extraColumns)
+		}
+	}
+	for _, k := range c.Added {
+		ew.printf("%s,%s,,%g,added\n", k.Metric, k.Labels, c.New[k].Value)
+	}
+	for _, k := range c.Removed {
+		ew.printf("%s,%s,%g,,removed\n", k.Metric, k.Labels, c.Old[k].Value)
+	}
+	return ew.err
+}
+
+func (c *Comparison) writeHTMLTable(w io.Writer) error {
+	ew := &errWriter{w: w}
+	ew.printf("<table>\n")
+	ew.printf("<thead><th>Metric</th><th>Labels</th><th>Baseline Value</th><th>New Value</th><th>Delta</th><th>Rule</th></thead>\n")
+	ew.printf("<tbody>\n")
+	for _, k := range c.Keys {
+		delta := c.Deltas[k]
+		rowBackground := "#fff"
+		cells := make([]string, 0)
+		cells = append(cells, k.Metric, k.Labels, c.Old[k].String(), c.New[k].String())
+		if delta.InsufficientData {
+			rowBackground = "lightgrey"
+			cells = append(cells, "insufficient data")
+		} else if c.Old[k].Value != 0 {
+			if delta.IsWarn {
+				rowBackground = "yellow"
+			}
+			if delta.IsError {
+				rowBackground = "orange"
+			}
+			if delta.IsImprovement {
+				rowBackground = "lightgreen"
+			}
+			cells = append(cells, fmt.Sprintf("%0.4f%%%s", delta.PercentChange, delta.statisticsSuffix()))
+		} else {
+			cells = append(cells, "n/a")
+		}
+		cells = append(cells, delta.FiredRule())
+		ew.printf("<tr style=\"background: %s;\">\n", rowBackground)
+		for _, cell := range cells {
+			ew.printf("<td>%s</td>", cell)
+		}
+		ew.printf("\n</tr>\n")
+	}
+	ew.printf("</tbody>\n</table>\n")
+
+	writeHTMLSeriesTable(ew, "Added series", "New Value", c.Added, c.New)
+	writeHTMLSeriesTable(ew, "Removed series", "Baseline Value", c.Removed, c.Old)
+	return ew.err
+}
+
+func writeHTMLSeriesTable(ew *errWriter, title, valueHeader string, keys []Key, m Map) {
+	if len(keys) == 0 {
+		return
+	}
+	ew.printf("<h4>%s (%d)</h4>\n", title, len(keys))
+	ew.printf("<table>\n")
+	ew.printf("<thead><th>Metric</th><th>Labels</th><th>%s</th></thead>\n", valueHeader)
+	ew.printf("<tbody>\n")
+	for _, k := range keys {
+		ew.printf("<tr>\n<td>%s</td><td>%s</td><td>%s</td>\n</tr>\n", k.Metric, k.Labels, m[k].String())
+	}
+	ew.printf("</tbody>\n</table>\n")
+}
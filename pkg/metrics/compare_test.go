@@ -0,0 +1,210 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testMap(values map[Key]float64) Map {
+	m := make(Map)
+	for k, v := range values {
+		m[k] = Series{Name: k.Metric, Value: v}
+	}
+	return m
+}
+
+func testCompareOptions(t *testing.T, warnAt, errorAt float64) CompareOptions {
+	thresholds, err := NewThresholds(Rule{Warn: warnAt, Error: errorAt}, nil)
+	require.NoError(t, err)
+	return CompareOptions{Thresholds: thresholds}
+}
+
+func TestWriteComparison_addedRemoved(t *testing.T) {
+	oldMap := testMap(map[Key]float64{
+		{Metric: "events", Labels: "Type=Pod"}:        10,
+		{Metric: "events", Labels: "Type=Deployment"}: 20,
+	})
+	newMap := testMap(map[Key]float64{
+		{Metric: "events", Labels: "Type=Pod"}:       10,
+		{Metric: "events", Labels: "Type=Namespace"}: 5,
+	})
+
+	for _, tt := range []struct {
+		format   string
+		expected string
+	}{
+		{
+			format: "plain",
+			expected: "events Type=Pod (old: 10.00, new 10.00): change: 0.0000%\n" +
+				"\nAdded series (1):\n" +
+				"events Type=Namespace (new 5.00)\n" +
+				"\nRemoved series (1):\n" +
+				"events Type=Deployment (old: 20.00)\n",
+		},
+		{
+			format: "csv",
+			expected: "metric,labels,old,new,change\n" +
+				"events,Type=Pod,10,10,0\n" +
+				"events,Type=Namespace,,5,added\n" +
+				"events,Type=Deployment,20,,removed\n",
+		},
+	} {
+		t.Run(tt.format, func(t *testing.T) {
+			var buff bytes.Buffer
+			c := Compare(oldMap, newMap, testCompareOptions(t, 0, 0))
+
+			require.NoError(t, WriteComparison(&buff, tt.format, c))
+			assert.False(t, c.Failed())
+			assert.Equal(t, tt.expected, buff.String())
+		})
+	}
+
+	t.Run("fail on removed", func(t *testing.T) {
+		opts := testCompareOptions(t, 0, 0)
+		opts.FailOnRemoved = true
+		assert.True(t, Compare(oldMap, newMap, opts).Failed())
+	})
+
+	t.Run("fail on added", func(t *testing.T) {
+		opts := testCompareOptions(t, 0, 0)
+		opts.FailOnAdded = true
+		assert.True(t, Compare(oldMap, newMap, opts).Failed())
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		assert.Error(t, WriteComparison(&bytes.Buffer{}, "yaml", Compare(oldMap, newMap, testCompareOptions(t, 0, 0))))
+	})
+}
+
+func TestWriteComparison_json(t *testing.T) {
+	oldMap := testMap(map[Key]float64{
+		{Metric: "events", Labels: "Type=Pod"}:        10,
+		{Metric: "events", Labels: "Type=Deployment"}: 20,
+	})
+	newMap := testMap(map[Key]float64{
+		{Metric: "events", Labels: "Type=Pod"}:       15,
+		{Metric: "events", Labels: "Type=Namespace"}: 5,
+	})
+
+	var buff bytes.Buffer
+	c := Compare(oldMap, newMap, testCompareOptions(t, 10, 40))
+	require.NoError(t, WriteComparison(&buff, "json", c))
+	assert.True(t, c.Failed())
+
+	var report map[string]interface{}
+	require.NoError(t, json.Unmarshal(buff.Bytes(), &report))
+	assert.Equal(t, map[string]interface{}{
+		"schemaVersion": 1.0,
+		"summary": map[string]interface{}{
+			"compared": 1.0, "errors": 1.0, "warnings": 0.0, "improvements": 0.0, "insufficientData": 0.0, "added": 1.0, "removed": 1.0,
+		},
+		"series": []interface{}{map[string]interface{}{
+			"name": "events", "labels": map[string]interface{}{}, "change": "compared",
+			"old": map[string]interface{}{"value": 10.0}, "new": map[string]interface{}{"value": 15.0},
+			"percentChange": 50.0, "absoluteChange": 5.0, "direction": "both", "status": "error",
+		}},
+		"added": []interface{}{map[string]interface{}{
+			"name": "events", "labels": map[string]interface{}{}, "change": "added", "new": map[string]interface{}{"value": 5.0},
+		}},
+		"removed": []interface{}{map[string]interface{}{
+			"name": "events", "labels": map[string]interface{}{}, "change": "removed", "old": map[string]interface{}{"value": 20.0},
+		}},
+	}, report)
+}
+
+func TestWriteComparison_markdown(t *testing.T) {
+	oldMap := testMap(map[Key]float64{
+		{Metric: "a_events", Labels: "Type=Pod"}:      10,
+		{Metric: "b_events", Labels: "Type=Pod"}:      10,
+		{Metric: "b_events", Labels: "Type=Secret"}:   10,
+		{Metric: "c_events", Labels: "Op=Get|Delete"}: 10,
+	})
+	newMap := testMap(map[Key]float64{
+		{Metric: "a_events", Labels: "Type=Pod"}:      10,
+		{Metric: "b_events", Labels: "Type=Pod"}:      10,
+		{Metric: "b_events", Labels: "Type=Secret"}:   20,
+		{Metric: "c_events", Labels: "Op=Get|Delete"}: 11.5,
+	})
+
+	var buff bytes.Buffer
+	require.NoError(t, WriteComparison(&buff, "markdown", Compare(oldMap, newMap, testCompareOptions(t, 10, 50))))
+
+	report := buff.String()
+	assert.Contains(t, report, "| **1** | **1** | 0 | 0 | 0 | 0 | 4 |")
+	assert.Contains(t, report, "2 series without warnings or errors are not listed.")
+	assert.Contains(t, report, "<summary>🔴 <code>b_events</code>: 1 error of 2 series</summary>")
+	assert.Contains(t, report, "| 🔴 | Type=Secret | 10.00 | 20.00 | **+100.00%** |  |\n\n</details>", "OK series are not listed")
+	assert.Contains(t, report, "| 🟡 | Op=Get\\|Delete |")
+	assert.NotContains(t, report, "a_events", "families without warnings or errors are not listed")
+
+	// Families are sorted by severity.
+	assert.Less(t, bytes.Index(buff.Bytes(), []byte("<code>b_events</code>")), bytes.Index(buff.Bytes(), []byte("<code>c_events</code>")))
+}
+
+func TestWriteComparison_markdownTruncated(t *testing.T) {
+	oldValues := make(map[Key]float64)
+	newValues := make(map[Key]float64)
+	for i := 0; i < 5000; i++ {
+		k := Key{Metric: fmt.Sprintf("events_%d", i%10), Labels: fmt.Sprintf("Index=%d", i)}
+		oldValues[k] = 10
+		newValues[k] = 20
+	}
+
+	var buff bytes.Buffer
+	require.NoError(t, WriteComparison(&buff, "markdown", Compare(testMap(oldValues), testMap(newValues), testCompareOptions(t, 10, 50))))
+
+	report := buff.String()
+	assert.LessOrEqual(t, len(report), markdownMaxLength)
+	assert.Contains(t, report, "| **5000** |")
+	assert.Regexp(t, `\n_Truncated to fit a GitHub comment, \d+ more series are not shown\.`, report)
+	assert.Equal(t, strings.Count(report, "<details"), strings.Count(report, "</details>"), "tables are closed")
+}
+
+func TestWriteComparison_junit(t *testing.T) {
+	oldMap := testMap(map[Key]float64{
+		{Metric: "events", Labels: "Type=Pod"}:        10,
+		{Metric: "events", Labels: "Type=Secret"}:     10,
+		{Metric: "events", Labels: "Type=Deployment"}: 20,
+		{Metric: "queue", Labels: ""}:                 10,
+	})
+	newMap := testMap(map[Key]float64{
+		{Metric: "events", Labels: "Type=Pod"}:    10,
+		{Metric: "events", Labels: "Type=Secret"}: 20,
+		{Metric: "queue", Labels: ""}:             12,
+	})
+
+	var buff bytes.Buffer
+	opts := testCompareOptions(t, 10, 50)
+	opts.FailOnRemoved = true
+	require.NoError(t, WriteComparison(&buff, "junit", Compare(oldMap, newMap, opts)))
+
+	var report junitTestSuites
+	require.NoError(t, xml.Unmarshal(buff.Bytes(), &report))
+
+	assert.Equal(t, 4, report.Tests)
+	assert.Equal(t, 2, report.Failures)
+	assert.Equal(t, 1, report.Skipped)
+	require.Len(t, report.Suites, 2)
+
+	events := report.Suites[0]
+	assert.Equal(t, "events", events.Name)
+	assert.Equal(t, 3, events.Tests)
+	assert.Equal(t, "Type=Secret", events.TestCases[1].Name)
+	require.NotNil(t, events.TestCases[1].Failure)
+	assert.Equal(t, "regression", events.TestCases[1].Failure.Type)
+	assert.Contains(t, events.TestCases[1].Failure.Message, "old 10.00, new 20.00, change +100.0000%")
+	require.NotNil(t, events.TestCases[2].Failure)
+	assert.Equal(t, "removed", events.TestCases[2].Failure.Type)
+
+	queue := report.Suites[1]
+	assert.Equal(t, "queue", queue.TestCases[0].Name)
+	require.NotNil(t, queue.TestCases[0].Skipped)
+	assert.Contains(t, queue.TestCases[0].Skipped.Message, "warning:")
+}
@@ -0,0 +1,183 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// DistributionTest is a statistical test comparing the bucket distributions of two histograms.
+type DistributionTest string
+
+const (
+	// DistributionTestKS is the two sample Kolmogorov-Smirnov test on the cumulative buckets.
+	DistributionTestKS DistributionTest = "ks"
+	// DistributionTestChiSquared is the chi-squared test of homogeneity on the counts per bucket.
+	DistributionTestChiSquared DistributionTest = "chi2"
+)
+
+// Validate returns an error if t is not a known distribution test. An empty test is valid and disables the test.
+func (t DistributionTest) Validate() error {
+	switch t {
+	case "", DistributionTestKS, DistributionTestChiSquared:
+		return nil
+	default:
+		return errors.Errorf("unknown distribution test %q (options are %s or %s)", t, DistributionTestKS, DistributionTestChiSquared)
+	}
+}
+
+// DistributionResult is the outcome of a distribution test. The p-value is the probability of a difference at least
+// as large as the observed one if both histograms were sampled from the same distribution.
+type DistributionResult struct {
+	Test      DistributionTest
+	Statistic float64
+	PValue    float64
+}
+
+func (r DistributionResult) String() string {
+	return fmt.Sprintf("%s: %0.4f p=%0.4g", r.Test, r.Statistic, r.PValue)
+}
+
+// CompareDistributions runs the test on the buckets of two histograms. Only the upper bounds present in both
+// histograms are used. It returns false if the histograms have no observations or no buckets in common.
+// As observations are only known per bucket, both tests are conservative compared to their continuous counterparts.
+func CompareDistributions(test DistributionTest, oldSeries, newSeries Series) (DistributionResult, bool) {
+	oldCounts, newCounts := commonBucketCounts(oldSeries, newSeries)
+	if len(oldCounts) < 2 {
+		return DistributionResult{}, false
+	}
+	oldTotal, newTotal := oldCounts[len(oldCounts)-1], newCounts[len(newCounts)-1]
+	if oldTotal <= 0 || newTotal <= 0 {
+		return DistributionResult{}, false
+	}
+
+	result := DistributionResult{Test: test}
+	switch test {
+	case DistributionTestKS:
+		for i := range oldCounts {
+			result.Statistic = math.Max(result.Statistic, math.Abs(oldCounts[i]/oldTotal-newCounts[i]/newTotal))
+		}
+		n := oldTotal * newTotal / (oldTotal + newTotal)
+		result.PValue = kolmogorovQ((math.Sqrt(n) + 0.12 + 0.11/math.Sqrt(n)) * result.Statistic)
+	case DistributionTestChiSquared:
+		var degrees float64
+		prevOld, prevNew := 0.0, 0.0
+		for i := range oldCounts {
+			oldCount, newCount := oldCounts[i]-prevOld, newCounts[i]-prevNew
+			prevOld, prevNew = oldCounts[i], newCounts[i]
+			if oldCount+newCount <= 0 {
+				continue
+			}
+			d := math.Sqrt(newTotal/oldTotal)*oldCount - math.Sqrt(oldTotal/newTotal)*newCount
+			result.Statistic += d * d / (oldCount + newCount)
+			degrees++
+		}
+		// One degree of freedom is lost to the totals.
+		degrees--
+		if degrees < 1 {
+			return DistributionResult{}, false
+		}
+		result.PValue = upperIncompleteGamma(degrees/2, result.Statistic/2)
+	default:
+		return DistributionResult{}, false
+	}
+	return result, true
+}
+
+// commonBucketCounts returns the cumulative counts of both series at the upper bounds present in both, ending with
+// the total count as +Inf bucket.
+func commonBucketCounts(oldSeries, newSeries Series) ([]float64, []float64) {
+	var oldCounts, newCounts []float64
+	j := 0
+	for _, b := range oldSeries.Buckets {
+		if math.IsInf(b.UpperBound, 1) {
+			break
+		}
+		for j < len(newSeries.Buckets) && newSeries.Buckets[j].UpperBound < b.UpperBound {
+			j++
+		}
+		if j < len(newSeries.Buckets) && newSeries.Buckets[j].UpperBound == b.UpperBound {
+			oldCounts = append(oldCounts, b.Count)
+			newCounts = append(newCounts, newSeries.Buckets[j].Count)
+		}
+	}
+	if len(oldCounts) == 0 {
+		return nil, nil
+	}
+	return append(oldCounts, totalCount(oldSeries)), append(newCounts, totalCount(newSeries))
+}
+
+// totalCount returns the count of the +Inf bucket, or the count of the series if the buckets do not include it.
+func totalCount(s Series) float64 {
+	if n := len(s.Buckets); n > 0 && math.IsInf(s.Buckets[n-1].UpperBound, 1) {
+		return s.Buckets[n-1].Count
+	}
+	return s.Count
+}
+
+// kolmogorovQ is the complementary cumulative distribution function of the Kolmogorov distribution.
+func kolmogorovQ(lambda float64) float64 {
+	if lambda < 0.2 {
+		return 1
+	}
+	var sum, sign = 0.0, 1.0
+	for j := 1.0; j <= 100; j++ {
+		term := sign * math.Exp(-2*j*j*lambda*lambda)
+		sum += term
+		if math.Abs(term) < 1e-12 {
+			break
+		}
+		sign = -sign
+	}
+	return math.Max(0, math.Min(1, 2*sum))
+}
+
+// upperIncompleteGamma is the regularized upper incomplete gamma function Q(a, x), the survival function of the
+// chi-squared distribution with 2a degrees of freedom at 2x. It uses the series expansion for x < a+1 and the
+// continued fraction otherwise.
+func upperIncompleteGamma(a, x float64) float64 {
+	if x <= 0 {
+		return 1
+	}
+	lgamma, _ := math.Lgamma(a)
+	prefix := math.Exp(-x + a*math.Log(x) - lgamma)
+
+	if x < a+1 {
+		sum, term := 1/a, 1/a
+		for n := 1.0; n < 1000; n++ {
+			term *= x / (a + n)
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*1e-15 {
+				break
+			}
+		}
+		return math.Max(0, 1-sum*prefix)
+	}
+
+	// Modified Lentz's method.
+	const tiny = 1e-300
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for i := 1.0; i < 1000; i++ {
+		an := -i * (i - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		del := d * c
+		h *= del
+		if math.Abs(del-1) < 1e-15 {
+			break
+		}
+	}
+	return prefix * h
+}
@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpperIncompleteGamma(t *testing.T) {
+	for _, tt := range []struct {
+		degrees, chiSquared, expected float64
+	}{
+		{degrees: 1, chiSquared: 3.841459, expected: 0.05},
+		{degrees: 10, chiSquared: 18.307038, expected: 0.05},
+		{degrees: 3, chiSquared: 0.584375, expected: 0.9},
+		{degrees: 4, chiSquared: 13.276704, expected: 0.01},
+		{degrees: 2, chiSquared: 0, expected: 1},
+	} {
+		assert.InDelta(t, tt.expected, upperIncompleteGamma(tt.degrees/2, tt.chiSquared/2), 1e-6, "df=%v x=%v", tt.degrees, tt.chiSquared)
+	}
+	assert.InDelta(t, math.Exp(-2.5), upperIncompleteGamma(1, 2.5), 1e-12)
+}
+
+func TestKolmogorovQ(t *testing.T) {
+	assert.InDelta(t, 0.27, kolmogorovQ(1), 1e-3)
+	assert.InDelta(t, 0.05, kolmogorovQ(1.358), 1e-3)
+	assert.InDelta(t, 0.001, kolmogorovQ(1.949), 1e-4)
+	assert.Equal(t, 1.0, kolmogorovQ(0))
+}
+
+func TestCompareDistributions(t *testing.T) {
+	histogram := func(counts ...float64) Series {
+		s := Series{}
+		for i, c := range counts {
+			s.Buckets = append(s.Buckets, Bucket{UpperBound: float64(i + 1), Count: c})
+		}
+		s.Buckets = append(s.Buckets, Bucket{UpperBound: math.Inf(1), Count: counts[len(counts)-1]})
+		s.Count = counts[len(counts)-1]
+		return s
+	}
+	// Cumulative counts of 1000 observations with the same and with a shifted distribution.
+	base := histogram(100, 400, 800, 1000)
+	same := histogram(200, 800, 1600, 2000)
+	shifted := histogram(50, 250, 650, 1000)
+
+	for _, test := range []DistributionTest{DistributionTestKS, DistributionTestChiSquared} {
+		t.Run(string(test), func(t *testing.T) {
+			result, ok := CompareDistributions(test, base, same)
+			require.True(t, ok)
+			assert.InDelta(t, 0, result.Statistic, 1e-9)
+			assert.InDelta(t, 1, result.PValue, 1e-9)
+
+			result, ok = CompareDistributions(test, base, shifted)
+			require.True(t, ok)
+			assert.Less(t, result.PValue, 1e-6)
+		})
+	}
+
+	result, _ := CompareDistributions(DistributionTestKS, base, shifted)
+	assert.InDelta(t, 0.15, result.Statistic, 1e-9)
+
+	result, _ = CompareDistributions(DistributionTestChiSquared, base, shifted)
+	// Per bucket counts 100/300/400/200 vs 50/200/400/350.
+	assert.InDelta(t, 50.0*50/150+100.0*100/500+0+150.0*150/550, result.Statistic, 1e-9)
+
+	_, ok := CompareDistributions(DistributionTestKS, base, Series{Buckets: []Bucket{{UpperBound: 0.5, Count: 1}}, Count: 1})
+	assert.False(t, ok, "no common buckets")
+	_, ok = CompareDistributions(DistributionTestKS, base, histogram(0, 0, 0, 0))
+	assert.False(t, ok, "no observations")
+}
+
+func TestRule_Evaluate_distribution(t *testing.T) {
+	k := Key{Metric: "sensor_event_duration"}
+	oldSeries := Series{Value: 2, Count: 1000, Buckets: []Bucket{{1, 500}, {2, 900}, {3, 1000}}}
+	newSeries := Series{Value: 2.2, Count: 1000, Buckets: []Bucket{{1, 400}, {2, 800}, {3, 1000}}}
+
+	rule := &Rule{DistributionTest: DistributionTestKS, ErrorP: 0.001, Direction: DirectionAuto}
+	delta := rule.Evaluate(k, oldSeries, newSeries)
+	require.NotNil(t, delta.Distribution)
+	assert.InDelta(t, 0.1, delta.Distribution.Statistic, 1e-9)
+	assert.True(t, delta.IsError)
+
+	delta = rule.Evaluate(k, newSeries, oldSeries)
+	assert.False(t, delta.IsError)
+	assert.True(t, delta.IsImprovement, "the mean decreased")
+
+	delta = (&Rule{Direction: DirectionAuto}).Evaluate(k, oldSeries, newSeries)
+	assert.Nil(t, delta.Distribution, "the test is disabled by default")
+}
+
+func TestRule_Evaluate_distributionTail(t *testing.T) {
+	k := Key{Metric: "sensor_event_duration"}
+	// Most observations got faster, lowering the mean, while the slowest 5% moved from below 10 to below 100.
+	oldSeries := Series{Value: 5, Count: 1000, Buckets: []Bucket{{1, 100}, {10, 1000}, {100, 1000}, {math.Inf(1), 1000}}}
+	newSeries := Series{Value: 4.9, Count: 1000, Buckets: []Bucket{{1, 600}, {10, 950}, {100, 1000}, {math.Inf(1), 1000}}}
+	require.Greater(t, HistogramQuantile(0.99, newSeries.Buckets, newSeries.Count), HistogramQuantile(0.99, oldSeries.Buckets, oldSeries.Count))
+
+	delta := (&Rule{DistributionTest: DistributionTestKS, ErrorP: 0.001, Direction: DirectionAuto}).Evaluate(k, oldSeries, newSeries)
+	require.NotNil(t, delta.Distribution)
+	assert.Less(t, delta.AbsChange, 0.0, "the mean improved")
+	assert.True(t, delta.IsError, "the tail regressed")
+	assert.False(t, delta.IsImprovement)
+
+	delta = (&Rule{DistributionTest: DistributionTestKS, WarnP: 0.001, Direction: DirectionAuto}).Evaluate(k, oldSeries, newSeries)
+	assert.True(t, delta.IsWarn)
+	assert.False(t, delta.IsError)
+}
@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// QuantileLabel is the label used to distinguish the quantile series derived from a histogram or summary.
+const QuantileLabel = "quantile"
+
+// Bucket is a single cumulative histogram bucket as exposed by Prometheus.
+type Bucket struct {
+	UpperBound float64
+	Count      float64
+}
+
+// parseBuckets converts the prom2json representation of buckets (upper bound -> cumulative count)
+// into a list of buckets sorted by upper bound.
+func parseBuckets(rawBuckets map[string]string) ([]Bucket, error) {
+	buckets := make([]Bucket, 0, len(rawBuckets))
+	for le, rawCount := range rawBuckets {
+		upperBound, err := strconv.ParseFloat(le, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid bucket upper bound %q", le)
+		}
+		count, err := strconv.ParseFloat(rawCount, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid bucket count %q", rawCount)
+		}
+		buckets = append(buckets, Bucket{UpperBound: upperBound, Count: count})
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].UpperBound < buckets[j].UpperBound
+	})
+	return buckets, nil
+}
+
+// HistogramQuantile calculates the quantile q from the given cumulative buckets using linear interpolation
+// within the bucket the quantile falls into. It follows the semantics of PromQL's histogram_quantile:
+// if the quantile falls into the +Inf bucket, the upper bound of the highest finite bucket is returned,
+// and the lower bound of the first bucket is assumed to be 0 if its upper bound is positive.
+// count is the total number of observations and is used when the buckets do not include +Inf.
+func HistogramQuantile(q float64, buckets []Bucket, count float64) float64 {
+	if q < 0 {
+		return math.Inf(-1)
+	}
+	if q > 1 {
+		return math.Inf(1)
+	}
+	if len(buckets) == 0 || math.IsNaN(q) {
+		return math.NaN()
+	}
+	if !math.IsInf(buckets[len(buckets)-1].UpperBound, 1) {
+		buckets = append(buckets[:len(buckets):len(buckets)], Bucket{UpperBound: math.Inf(1), Count: count})
+	}
+	if len(buckets) < 2 {
+		return math.NaN()
+	}
+
+	observations := buckets[len(buckets)-1].Count
+	if observations == 0 {
+		return math.NaN()
+	}
+	rank := q * observations
+	b := sort.Search(len(buckets)-1, func(i int) bool { return buckets[i].Count >= rank })
+
+	if b == len(buckets)-1 {
+		return buckets[len(buckets)-2].UpperBound
+	}
+	if b == 0 && buckets[0].UpperBound <= 0 {
+		return buckets[0].UpperBound
+	}
+
+	var (
+		bucketStart float64
+		bucketEnd   = buckets[b].UpperBound
+		bucketCount = buckets[b].Count
+	)
+	if b > 0 {
+		bucketStart = buckets[b-1].UpperBound
+		bucketCount -= buckets[b-1].Count
+		rank -= buckets[b-1].Count
+	}
+	if bucketCount == 0 {
+		return bucketStart
+	}
+	return bucketStart + (bucketEnd-bucketStart)*(rank/bucketCount)
+}
+
+// ParseQuantiles parses a comma separated list of quantiles e.g. 0.5,0.9,0.99.
+func ParseQuantiles(optQuantiles string) ([]float64, error) {
+	var quantiles []float64
+	for _, raw := range strings.Split(optQuantiles, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		q, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid quantile %q", raw)
+		}
+		if q < 0 || q > 1 {
+			return nil, errors.Errorf("quantile %q must be between 0 and 1", raw)
+		}
+		quantiles = append(quantiles, q)
+	}
+	return quantiles, nil
+}
+
+// FormatQuantile formats the quantile as used in the quantile label.
+func FormatQuantile(q float64) string {
+	return strconv.FormatFloat(q, 'g', -1, 64)
+}
+
+// withQuantile returns a copy of labels with the quantile label set.
+func withQuantile(labels map[string]string, quantile string) Labels {
+	result := make(Labels, len(labels)+1)
+	for k, v := range labels {
+		result[k] = v
+	}
+	result[QuantileLabel] = quantile
+	return result
+}
+
+// withoutQuantile returns a copy of the labels without the quantile label.
+func withoutQuantile(labels map[string]string) Labels {
+	result := make(Labels, len(labels))
+	for k, v := range labels {
+		if k != QuantileLabel {
+			result[k] = v
+		}
+	}
+	return result
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogramQuantile(t *testing.T) {
+	buckets := []Bucket{
+		{UpperBound: 4, Count: 86},
+		{UpperBound: 8, Count: 182},
+		{UpperBound: 16, Count: 286},
+		{UpperBound: 32, Count: 340},
+		{UpperBound: math.Inf(1), Count: 351},
+	}
+
+	for _, tt := range []struct {
+		name     string
+		q        float64
+		buckets  []Bucket
+		count    float64
+		expected float64
+	}{
+		{name: "median", q: 0.5, buckets: buckets, count: 351, expected: 4 + 4*(175.5-86)/96},
+		{name: "first bucket starts at zero", q: 0.1, buckets: buckets, count: 351, expected: 4 * 35.1 / 86},
+		{name: "+Inf bucket returns highest finite bound", q: 0.99, buckets: buckets, count: 351, expected: 32},
+		{name: "zero quantile", q: 0, buckets: buckets, count: 351, expected: 0},
+		{name: "missing +Inf bucket uses count", q: 0.99, buckets: buckets[:2], count: 351, expected: 8},
+		{name: "negative upper bound", q: 0.1, buckets: []Bucket{{UpperBound: -1, Count: 5}, {UpperBound: math.Inf(1), Count: 10}}, count: 10, expected: -1},
+		{name: "below zero", q: -1, buckets: buckets, count: 351, expected: math.Inf(-1)},
+		{name: "above one", q: 2, buckets: buckets, count: 351, expected: math.Inf(1)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.expected, HistogramQuantile(tt.q, tt.buckets, tt.count), 1e-9)
+		})
+	}
+
+	assert.True(t, math.IsNaN(HistogramQuantile(0.5, nil, 0)))
+	assert.True(t, math.IsNaN(HistogramQuantile(0.5, []Bucket{{UpperBound: math.Inf(1)}}, 0)))
+}
+
+func TestParseQuantiles(t *testing.T) {
+	quantiles, err := ParseQuantiles("0.5, 0.9,,0.99")
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{0.5, 0.9, 0.99}, quantiles)
+
+	_, err = ParseQuantiles("1.5")
+	assert.Error(t, err)
+
+	_, err = ParseQuantiles("p99")
+	assert.Error(t, err)
+}
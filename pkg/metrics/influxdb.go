@@ -0,0 +1,147 @@
+package metrics
+
+import (
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/maps"
+)
+
+var (
+	// influxDBMeasurementEscaper escapes measurement names. Newlines cannot be represented and become spaces.
+	influxDBMeasurementEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, " ", `\ `, "\n", `\ `)
+	// influxDBKeyEscaper escapes tag keys, tag values and field keys.
+	influxDBKeyEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, "=", `\=`, " ", `\ `, "\n", `\ `)
+)
+
+// influxDBField is a float field of an influxdb line.
+type influxDBField struct {
+	key   string
+	value float64
+}
+
+// influxDBLine returns a line of the InfluxDB line protocol without the trailing newline. Tags are sorted by key and
+// the series labels take precedence over the additional labels. Tags with an empty key or value are omitted, as are
+// NaN and infinite fields which influxdb cannot store. An empty string is returned if no field is left.
+func influxDBLine(measurement string, labels, additional map[string]string, fields []influxDBField, timestamp int64) string {
+	var b strings.Builder
+	for _, f := range fields {
+		if f.key == "" || math.IsNaN(f.value) || math.IsInf(f.value, 0) {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(influxDBKeyEscaper.Replace(f.key))
+		b.WriteByte('=')
+		b.WriteString(strconv.FormatFloat(f.value, 'g', -1, 64))
+	}
+	if b.Len() == 0 || measurement == "" {
+		return ""
+	}
+	fieldSet := b.String()
+
+	tags := make(map[string]string, len(labels)+len(additional))
+	for k, v := range additional {
+		tags[k] = v
+	}
+	for k, v := range labels {
+		tags[k] = v
+	}
+	tagKeys := maps.Keys(tags)
+	slices.Sort(tagKeys)
+
+	b.Reset()
+	b.WriteString(influxDBMeasurementEscaper.Replace(measurement))
+	for _, k := range tagKeys {
+		if k == "" || tags[k] == "" {
+			continue
+		}
+		b.WriteByte(',')
+		b.WriteString(influxDBKeyEscaper.Replace(k))
+		b.WriteByte('=')
+		b.WriteString(influxDBKeyEscaper.Replace(tags[k]))
+	}
+	b.WriteByte(' ')
+	b.WriteString(fieldSet)
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatInt(timestamp, 10))
+	return b.String()
+}
+
+func (m Map) writeInfluxDBLineProtocol(w io.Writer, keys []Key, opts WriteOptions) error {
+	if opts.InfluxDBFields {
+		return m.writeInfluxDBFields(w, keys, opts)
+	}
+	ew := &errWriter{w: w}
+	for _, k := range keys {
+		line := influxDBLine(k.Metric, m[k].Labels, opts.Labels, []influxDBField{{key: "value", value: m[k].Value}}, opts.Timestamp)
+		if line != "" {
+			ew.printf("%s\n", line)
+		}
+	}
+	return ew.err
+}
+
+// writeInfluxDBFields writes a line with sum, count, mean and quantile fields per histogram and summary, and a line
+// with a value field per counter and gauge.
+func (m Map) writeInfluxDBFields(w io.Writer, keys []Key, opts WriteOptions) error {
+	type group struct {
+		name   string
+		labels Labels
+		fields []influxDBField
+	}
+	groups := make(map[Key]*group)
+	var groupKeys []Key
+	for _, k := range keys {
+		s := m[k]
+		labels := s.Labels
+		isDistribution := s.Family != nil && (s.Family.Type == "HISTOGRAM" || s.Family.Type == "SUMMARY")
+		quantile, isQuantile := labels[QuantileLabel]
+		isQuantile = isQuantile && isDistribution
+		if isQuantile {
+			labels = withoutQuantile(labels)
+		}
+		gk := Key{Metric: k.Metric, Labels: labels.String()}
+		g, ok := groups[gk]
+		if !ok {
+			g = &group{name: k.Metric, labels: labels}
+			groups[gk] = g
+			groupKeys = append(groupKeys, gk)
+		}
+		switch {
+		case isQuantile:
+			g.fields = append(g.fields, influxDBField{key: quantileFieldKey(quantile), value: s.Value})
+		case isDistribution:
+			g.fields = append([]influxDBField{
+				{key: "sum", value: s.Sum},
+				{key: "count", value: s.Count},
+				{key: "mean", value: s.Value},
+			}, g.fields...)
+		default:
+			g.fields = append([]influxDBField{{key: "value", value: s.Value}}, g.fields...)
+		}
+	}
+
+	SortKeys(groupKeys)
+	ew := &errWriter{w: w}
+	for _, gk := range groupKeys {
+		g := groups[gk]
+		if line := influxDBLine(g.name, g.labels, opts.Labels, g.fields, opts.Timestamp); line != "" {
+			ew.printf("%s\n", line)
+		}
+	}
+	return ew.err
+}
+
+// quantileFieldKey returns the field key of a quantile as a percentile, e.g. p99 for 0.99 and p99.9 for 0.999.
+func quantileFieldKey(quantile string) string {
+	q, err := strconv.ParseFloat(quantile, 64)
+	if err != nil {
+		return "q" + quantile
+	}
+	return "p" + strconv.FormatFloat(q*100, 'g', 10, 64)
+}
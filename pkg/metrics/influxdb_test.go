@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/prometheus/prom2json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInfluxDBLine(t *testing.T) {
+	value := []influxDBField{{key: "value", value: 1.5}}
+	for _, tt := range []struct {
+		name        string
+		measurement string
+		labels      map[string]string
+		additional  map[string]string
+		fields      []influxDBField
+		expected    string
+	}{
+		{
+			name:        "sorted tags",
+			measurement: "requests",
+			labels:      map[string]string{"Type": "Pod", "Op": "Get"},
+			additional:  map[string]string{"Test": "ci", "A": "a"},
+			fields:      value,
+			expected:    "requests,A=a,Op=Get,Test=ci,Type=Pod value=1.5 1700000000",
+		},
+		{
+			name:        "tag escaping",
+			measurement: "requests",
+			labels:      map[string]string{"Op": "SELECT a, b FROM t WHERE c = 1", "k=v": `trailing\`},
+			fields:      value,
+			expected:    `requests,Op=SELECT\ a\,\ b\ FROM\ t\ WHERE\ c\ \=\ 1,k\=v=trailing\\ value=1.5 1700000000`,
+		},
+		{
+			name:        "measurement escaping",
+			measurement: "a metric,with=chars",
+			fields:      value,
+			expected:    `a\ metric\,with=chars value=1.5 1700000000`,
+		},
+		{
+			name:        "newlines",
+			measurement: "requests",
+			labels:      map[string]string{"Query": "query {\n  id\n}"},
+			fields:      value,
+			expected:    `requests,Query=query\ {\ \ \ id\ } value=1.5 1700000000`,
+		},
+		{
+			name:        "empty tags are omitted",
+			measurement: "requests",
+			labels:      map[string]string{"Op": "", "": "x"},
+			additional:  map[string]string{"Test": ""},
+			fields:      value,
+			expected:    "requests value=1.5 1700000000",
+		},
+		{
+			name:        "series labels take precedence",
+			measurement: "requests",
+			labels:      map[string]string{"Type": "Pod"},
+			additional:  map[string]string{"Type": "ci"},
+			fields:      value,
+			expected:    "requests,Type=Pod value=1.5 1700000000",
+		},
+		{
+			name:        "full precision",
+			measurement: "requests",
+			fields:      []influxDBField{{key: "value", value: 1234567.891}, {key: "small", value: 1e-9}},
+			expected:    "requests value=1.234567891e+06,small=1e-09 1700000000",
+		},
+		{
+			name:        "invalid fields are omitted",
+			measurement: "requests",
+			fields:      []influxDBField{{key: "mean", value: math.NaN()}, {key: "max", value: math.Inf(1)}, {key: "count", value: 0}},
+			expected:    "requests count=0 1700000000",
+		},
+		{
+			name:        "no fields",
+			measurement: "requests",
+			fields:      []influxDBField{{key: "mean", value: math.NaN()}},
+			expected:    "",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, influxDBLine(tt.measurement, tt.labels, tt.additional, tt.fields, 1700000000))
+		})
+	}
+}
+
+func TestWriteSeries_influxDBFields(t *testing.T) {
+	histogram := &prom2json.Family{Type: "HISTOGRAM"}
+	counter := &prom2json.Family{Type: "COUNTER"}
+	pod := Labels{"Type": "Pod"}
+	m := Map{
+		{Metric: "duration", Labels: "Type=Pod"}: {
+			Labels: pod, Value: 1.25, Sum: 50, Count: 40, Family: histogram,
+		},
+		{Metric: "duration", Labels: "Type=Pod quantile=0.5"}: {
+			Labels: withQuantile(pod, "0.5"), Value: 1.3, Sum: 50, Count: 40, Family: histogram,
+		},
+		{Metric: "duration", Labels: "Type=Pod quantile=0.999"}: {
+			Labels: withQuantile(pod, "0.999"), Value: 1.99, Sum: 50, Count: 40, Family: histogram,
+		},
+		{Metric: "requests_total", Labels: "Type=Pod"}: {Labels: pod, Value: 150, Family: counter},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteSeries(&buf, "influxdb", m, WriteOptions{Timestamp: 1700000000, InfluxDBFields: true}))
+	assert.Equal(t, "duration,Type=Pod sum=50,count=40,mean=1.25,p50=1.3,p99.9=1.99 1700000000\n"+
+		"requests_total,Type=Pod value=150 1700000000\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, WriteSeries(&buf, "influxdb", m, WriteOptions{Timestamp: 1700000000}))
+	assert.Equal(t, "duration,Type=Pod value=1.25 1700000000\n"+
+		"duration,Type=Pod,quantile=0.5 value=1.3 1700000000\n"+
+		"duration,Type=Pod,quantile=0.999 value=1.99 1700000000\n"+
+		"requests_total,Type=Pod value=150 1700000000\n", buf.String())
+}
@@ -0,0 +1,174 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prom2json"
+)
+
+const (
+	// StdinPath is the path which reads the metrics from stdin.
+	StdinPath    = "-"
+	acceptHeader = "text/plain;version=0.0.4;q=1.0,*/*;q=0.1"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// InputOptions control how metrics are read.
+type InputOptions struct {
+	// BearerToken is sent when scraping an http(s) endpoint.
+	BearerToken string
+	// BearerTokenFile contains the token sent when scraping an http(s) endpoint and takes precedence over BearerToken.
+	BearerTokenFile string
+	// CAFile is a PEM encoded CA bundle used to verify an https endpoint.
+	CAFile string
+	// Timeout of scraping an http(s) endpoint.
+	Timeout time.Duration
+	// Lenient skips malformed metric families instead of failing.
+	Lenient bool
+}
+
+// ReadFile parses the metrics from path, which is either a local file, - for stdin or an http(s) URL.
+// Gzip and zstd compressed input is decompressed transparently. In lenient mode, the errors of the skipped
+// malformed metric families are returned alongside the parsed families.
+func ReadFile(path string, opts InputOptions) ([]*prom2json.Family, []error, error) {
+	in, err := Open(path, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+
+	families, dropped, err := Parse(in, opts.Lenient)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error parsing %s", path)
+	}
+	return families, dropped, nil
+}
+
+// Open opens path for reading the metrics, decompressing gzip and zstd transparently. See ReadFile.
+func Open(path string, opts InputOptions) (io.ReadCloser, error) {
+	var (
+		raw io.ReadCloser
+		err error
+	)
+	switch {
+	case path == StdinPath:
+		raw = io.NopCloser(os.Stdin)
+	case strings.HasPrefix(path, "http://"), strings.HasPrefix(path, "https://"):
+		raw, err = scrape(path, opts)
+	default:
+		raw, err = os.Open(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	in, err := decompress(raw)
+	if err != nil {
+		_ = raw.Close()
+		return nil, errors.Wrapf(err, "error decompressing %s", path)
+	}
+	return in, nil
+}
+
+// decompress detects gzip and zstd compressed input by its magic bytes and returns a reader of the
+// decompressed data. Any other input is returned as is.
+func decompress(raw io.ReadCloser) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(raw)
+	magic, err := buffered.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		return &readCloser{Reader: gz, closers: []io.Closer{gz, raw}}, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		return &readCloser{Reader: zr, closers: []io.Closer{zr.IOReadCloser(), raw}}, nil
+	default:
+		return &readCloser{Reader: buffered, closers: []io.Closer{raw}}, nil
+	}
+}
+
+func scrape(url string, opts InputOptions) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", acceptHeader)
+
+	token := opts.BearerToken
+	if opts.BearerTokenFile != "" {
+		data, err := os.ReadFile(opts.BearerTokenFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading bearer token file")
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading CA file")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificates found in %s", opts.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	client := &http.Client{Transport: transport, Timeout: opts.Timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error scraping %s", url)
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, errors.Errorf("error scraping %s: unexpected status %s", url, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *readCloser) Close() error {
+	var firstErr error
+	for _, c := range r.closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
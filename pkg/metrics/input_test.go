@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadFile_compressed(t *testing.T) {
+	data, err := os.ReadFile("testdata/sample.txt")
+	require.NoError(t, err)
+	expected, _, err := ReadFile("testdata/sample.txt", InputOptions{})
+	require.NoError(t, err)
+
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	_, err = gz.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	zstdEncoder, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	zstded := zstdEncoder.EncodeAll(data, nil)
+
+	for name, content := range map[string][]byte{
+		"metrics.gz":  gzipped.Bytes(),
+		"metrics.zst": zstded,
+		// Compression is detected by content, not by the file extension.
+		"metrics.txt": gzipped.Bytes(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			require.NoError(t, os.WriteFile(path, content, 0o600))
+
+			families, _, err := ReadFile(path, InputOptions{})
+			require.NoError(t, err)
+			assert.ElementsMatch(t, expected, families)
+		})
+	}
+}
+
+func TestReadFile_http(t *testing.T) {
+	data, err := os.ReadFile("testdata/sample.txt")
+	require.NoError(t, err)
+	expected, _, err := ReadFile("testdata/sample.txt", InputOptions{})
+	require.NoError(t, err)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write(data)
+	})
+
+	t.Run("bearer token", func(t *testing.T) {
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		families, _, err := ReadFile(server.URL+"/metrics", InputOptions{BearerToken: "secret"})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, expected, families)
+	})
+
+	t.Run("bearer token file", func(t *testing.T) {
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		tokenFile := filepath.Join(t.TempDir(), "token")
+		require.NoError(t, os.WriteFile(tokenFile, []byte("secret\n"), 0o600))
+
+		families, _, err := ReadFile(server.URL+"/metrics", InputOptions{BearerTokenFile: tokenFile})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, expected, families)
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		_, _, err := ReadFile(server.URL+"/metrics", InputOptions{})
+		assert.ErrorContains(t, err, "401")
+	})
+
+	t.Run("tls ca", func(t *testing.T) {
+		server := httptest.NewTLSServer(handler)
+		defer server.Close()
+
+		_, _, err := ReadFile(server.URL+"/metrics", InputOptions{BearerToken: "secret"})
+		assert.Error(t, err)
+
+		caFile := filepath.Join(t.TempDir(), "ca.pem")
+		caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+		require.NoError(t, os.WriteFile(caFile, caPEM, 0o600))
+
+		families, _, err := ReadFile(server.URL+"/metrics", InputOptions{BearerToken: "secret", CAFile: caFile})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, expected, families)
+	})
+}
@@ -0,0 +1,268 @@
+package metrics
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// jsonSchemaVersion is incremented on every incompatible change of the json and jsonl output.
+// Adding fields is not considered an incompatible change.
+const jsonSchemaVersion = 1
+
+// jsonFloat is a float64 which is encoded as null if it is NaN or infinite, as JSON cannot represent these values.
+type jsonFloat float64
+
+func (f jsonFloat) MarshalJSON() ([]byte, error) {
+	v := float64(f)
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return []byte("null"), nil
+	}
+	return strconv.AppendFloat(nil, v, 'g', -1, 64), nil
+}
+
+type jsonValue struct {
+	Value    jsonFloat     `json:"value"`
+	Sum      *jsonFloat    `json:"sum,omitempty"`
+	Count    *jsonFloat    `json:"count,omitempty"`
+	Baseline *jsonBaseline `json:"baseline,omitempty"`
+}
+
+type jsonBaseline struct {
+	Runs   int       `json:"runs"`
+	Mean   jsonFloat `json:"mean"`
+	StdDev jsonFloat `json:"stddev"`
+	Min    jsonFloat `json:"min"`
+	Max    jsonFloat `json:"max"`
+}
+
+type jsonSeries struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels"`
+	Type   string            `json:"type,omitempty"`
+	Help   string            `json:"help,omitempty"`
+	jsonValue
+}
+
+type jsonSingleReport struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	Series        []jsonSeries      `json:"series"`
+}
+
+type jsonComparedSeries struct {
+	Name           string            `json:"name"`
+	Labels         map[string]string `json:"labels"`
+	Type           string            `json:"type,omitempty"`
+	Help           string            `json:"help,omitempty"`
+	Change         string            `json:"change"`
+	Old            *jsonValue        `json:"old,omitempty"`
+	New            *jsonValue        `json:"new,omitempty"`
+	PercentChange  *jsonFloat        `json:"percentChange,omitempty"`
+	AbsoluteChange *jsonFloat        `json:"absoluteChange,omitempty"`
+	ZScore         *jsonFloat        `json:"zScore,omitempty"`
+	OutsideRange   bool              `json:"outsideRange,omitempty"`
+	Distribution   *jsonDistribution `json:"distribution,omitempty"`
+	Direction      string            `json:"direction,omitempty"`
+	Status         string            `json:"status,omitempty"`
+	Rule           string            `json:"rule,omitempty"`
+}
+
+type jsonDistribution struct {
+	Test      string    `json:"test"`
+	Statistic jsonFloat `json:"statistic"`
+	PValue    jsonFloat `json:"pValue"`
+}
+
+type jsonCompareSummary struct {
+	Compared         int `json:"compared"`
+	Errors           int `json:"errors"`
+	Warnings         int `json:"warnings"`
+	Improvements     int `json:"improvements"`
+	InsufficientData int `json:"insufficientData"`
+	Added            int `json:"added"`
+	Removed          int `json:"removed"`
+}
+
+type jsonCompareReport struct {
+	SchemaVersion int                  `json:"schemaVersion"`
+	Summary       jsonCompareSummary   `json:"summary"`
+	Series        []jsonComparedSeries `json:"series"`
+	Added         []jsonComparedSeries `json:"added"`
+	Removed       []jsonComparedSeries `json:"removed"`
+}
+
+func newJSONValue(s Series) jsonValue {
+	v := jsonValue{Value: jsonFloat(s.Value)}
+	if s.HasObservations() {
+		sum, count := jsonFloat(s.Sum), jsonFloat(s.Count)
+		v.Sum, v.Count = &sum, &count
+	}
+	if b := s.Baseline; b != nil {
+		v.Baseline = &jsonBaseline{
+			Runs:   b.Runs,
+			Mean:   jsonFloat(b.Mean),
+			StdDev: jsonFloat(b.StdDev),
+			Min:    jsonFloat(b.Min),
+			Max:    jsonFloat(b.Max),
+		}
+	}
+	return v
+}
+
+func newJSONSeries(series Series) jsonSeries {
+	s := jsonSeries{
+		Name:      series.Name,
+		Labels:    series.Labels,
+		jsonValue: newJSONValue(series),
+	}
+	if s.Labels == nil {
+		s.Labels = map[string]string{}
+	}
+	if series.Family != nil {
+		s.Type, s.Help = series.Family.Type, series.Family.Help
+	}
+	return s
+}
+
+func newJSONComparedSeries(change string, oldSeries, newSeries *Series, delta *Delta) jsonComparedSeries {
+	var series jsonSeries
+	if newSeries != nil {
+		series = newJSONSeries(*newSeries)
+	} else {
+		series = newJSONSeries(*oldSeries)
+	}
+	s := jsonComparedSeries{
+		Name:   series.Name,
+		Labels: series.Labels,
+		Type:   series.Type,
+		Help:   series.Help,
+		Change: change,
+	}
+	if oldSeries != nil {
+		v := newJSONValue(*oldSeries)
+		s.Old = &v
+	}
+	if newSeries != nil {
+		v := newJSONValue(*newSeries)
+		s.New = &v
+	}
+	if delta != nil {
+		absChange := jsonFloat(delta.AbsChange)
+		s.AbsoluteChange = &absChange
+		if oldSeries.Value != 0 && !delta.InsufficientData {
+			percentChange := jsonFloat(delta.PercentChange)
+			s.PercentChange = &percentChange
+		}
+		if delta.HasZScore {
+			zScore := jsonFloat(delta.ZScore)
+			s.ZScore = &zScore
+		}
+		s.OutsideRange = delta.OutsideRange
+		if d := delta.Distribution; d != nil {
+			s.Distribution = &jsonDistribution{
+				Test:      string(d.Test),
+				Statistic: jsonFloat(d.Statistic),
+				PValue:    jsonFloat(d.PValue),
+			}
+		}
+		s.Direction = string(delta.Direction)
+		s.Status = string(delta.Status())
+		s.Rule = delta.FiredRule()
+	}
+	return s
+}
+
+func (m Map) writeJSON(w io.Writer, keys []Key, labels map[string]string) error {
+	report := jsonSingleReport{
+		SchemaVersion: jsonSchemaVersion,
+		Labels:        labels,
+		Series:        make([]jsonSeries, 0, len(keys)),
+	}
+	for _, k := range keys {
+		report.Series = append(report.Series, newJSONSeries(m[k]))
+	}
+	return writeJSON(w, report)
+}
+
+func (m Map) writeJSONLines(w io.Writer, keys []Key) error {
+	for _, k := range keys {
+		if err := writeJSON(w, newJSONSeries(m[k])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Comparison) writeJSON(w io.Writer) error {
+	report := jsonCompareReport{
+		SchemaVersion: jsonSchemaVersion,
+		Series:        make([]jsonComparedSeries, 0, len(c.Keys)),
+		Added:         make([]jsonComparedSeries, 0, len(c.Added)),
+		Removed:       make([]jsonComparedSeries, 0, len(c.Removed)),
+	}
+	_ = c.forEachJSONComparedSeries(func(s jsonComparedSeries) error {
+		switch s.Change {
+		case "added":
+			report.Added = append(report.Added, s)
+		case "removed":
+			report.Removed = append(report.Removed, s)
+		default:
+			report.Series = append(report.Series, s)
+		}
+		return nil
+	})
+	report.Summary = jsonCompareSummary{
+		Compared: len(c.Keys),
+		Added:    len(c.Added),
+		Removed:  len(c.Removed),
+	}
+	for _, k := range c.Keys {
+		switch c.Deltas[k].Status() {
+		case StatusError:
+			report.Summary.Errors++
+		case StatusWarn:
+			report.Summary.Warnings++
+		case StatusImprovement:
+			report.Summary.Improvements++
+		case StatusInsufficientData:
+			report.Summary.InsufficientData++
+		}
+	}
+	return writeJSON(w, report)
+}
+
+func (c *Comparison) writeJSONLines(w io.Writer) error {
+	return c.forEachJSONComparedSeries(func(s jsonComparedSeries) error {
+		return writeJSON(w, s)
+	})
+}
+
+func (c *Comparison) forEachJSONComparedSeries(f func(jsonComparedSeries) error) error {
+	for _, k := range c.Keys {
+		oldSeries, newSeries, delta := c.Old[k], c.New[k], c.Deltas[k]
+		if err := f(newJSONComparedSeries("compared", &oldSeries, &newSeries, &delta)); err != nil {
+			return err
+		}
+	}
+	for _, k := range c.Added {
+		newSeries := c.New[k]
+		if err := f(newJSONComparedSeries("added", nil, &newSeries, nil)); err != nil {
+			return err
+		}
+	}
+	for _, k := range c.Removed {
+		oldSeries := c.Old[k]
+		if err := f(newJSONComparedSeries("removed", &oldSeries, nil, nil)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	return errors.Wrap(json.NewEncoder(w).Encode(v), "error writing json")
+}
@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name          `xml:"testsuites"`
+	Name     string            `xml:"name,attr"`
+	Tests    int               `xml:"tests,attr"`
+	Failures int               `xml:"failures,attr"`
+	Skipped  int               `xml:"skipped,attr"`
+	Suites   []*junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string           `xml:"name,attr"`
+	Tests     int              `xml:"tests,attr"`
+	Failures  int              `xml:"failures,attr"`
+	Skipped   int              `xml:"skipped,attr"`
+	TestCases []*junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit writes the comparison as JUnit XML with one testsuite per metric family and one testcase per series.
+// Errors become failures, warnings and insufficient data are skipped with an explanation, and added or removed series
+// are failures if the comparison fails on them and skipped otherwise.
+func (c *Comparison) writeJUnit(w io.Writer) error {
+	report := &junitTestSuites{Name: "metrics comparison"}
+	suites := make(map[string]*junitTestSuite)
+	addTestCase := func(k Key, testCase *junitTestCase) {
+		suite, ok := suites[k.Metric]
+		if !ok {
+			suite = &junitTestSuite{Name: k.Metric}
+			suites[k.Metric] = suite
+			report.Suites = append(report.Suites, suite)
+		}
+		testCase.ClassName = k.Metric
+		testCase.Time = "0"
+		testCase.Name = k.Labels
+		if testCase.Name == "" {
+			testCase.Name = k.Metric
+		}
+		suite.TestCases = append(suite.TestCases, testCase)
+		suite.Tests++
+		report.Tests++
+		if testCase.Failure != nil {
+			suite.Failures++
+			report.Failures++
+		}
+		if testCase.Skipped != nil {
+			suite.Skipped++
+			report.Skipped++
+		}
+	}
+
+	for _, k := range c.Keys {
+		delta := c.Deltas[k]
+		description := fmt.Sprintf("%s %s: old %s, new %s", k.Metric, k.Labels, c.Old[k].String(), c.New[k].String())
+		if c.Old[k].Value != 0 && !delta.InsufficientData {
+			description += fmt.Sprintf(", change %+0.4f%%", delta.PercentChange)
+		}
+		if delta.HasZScore {
+			description += fmt.Sprintf(", z-score %+0.2f", delta.ZScore)
+		}
+		if delta.Distribution != nil {
+			description += ", " + delta.Distribution.String()
+		}
+		if rule := delta.FiredRule(); rule != "" {
+			description += fmt.Sprintf(" (rule: %s)", rule)
+		}
+
+		testCase := &junitTestCase{SystemOut: description}
+		switch delta.Status() {
+		case StatusError:
+			testCase.Failure = &junitMessage{Message: "regression: " + description, Type: "regression", Text: description}
+		case StatusWarn:
+			testCase.Skipped = &junitMessage{Message: "warning: " + description}
+		case StatusInsufficientData:
+			testCase.Skipped = &junitMessage{Message: "insufficient data: " + description}
+		}
+		addTestCase(k, testCase)
+	}
+	for _, k := range c.Added {
+		description := fmt.Sprintf("%s %s: only present in the new file (new %s)", k.Metric, k.Labels, c.New[k].String())
+		addTestCase(k, changedSeriesTestCase("added", description, c.Options.FailOnAdded))
+	}
+	for _, k := range c.Removed {
+		description := fmt.Sprintf("%s %s: only present in the old file (old %s)", k.Metric, k.Labels, c.Old[k].String())
+		addTestCase(k, changedSeriesTestCase("removed", description, c.Options.FailOnRemoved))
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return errors.Wrap(err, "error writing junit")
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return errors.Wrap(err, "error writing junit")
+	}
+	_, err := io.WriteString(w, "\n")
+	return errors.Wrap(err, "error writing junit")
+}
+
+func changedSeriesTestCase(change, description string, fail bool) *junitTestCase {
+	testCase := &junitTestCase{SystemOut: description}
+	if fail {
+		testCase.Failure = &junitMessage{Message: description, Type: change, Text: description}
+	} else {
+		testCase.Skipped = &junitMessage{Message: description}
+	}
+	return testCase
+}
@@ -0,0 +1,191 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// severity orders delta statuses for the markdown report, the most severe first.
+var severity = map[Status]int{
+	StatusError:            4,
+	StatusWarn:             3,
+	StatusImprovement:      2,
+	StatusInsufficientData: 1,
+	StatusOK:               0,
+}
+
+var statusMarkers = map[Status]string{
+	StatusError:            "🔴",
+	StatusWarn:             "🟡",
+	StatusImprovement:      "🟢",
+	StatusInsufficientData: "⚪",
+}
+
+const (
+	// markdownMaxLength is the maximum length of a GitHub comment. Bytes are counted, which is conservative for
+	// multi-byte characters.
+	markdownMaxLength = 65536
+	// markdownReserve is kept free for closing the current table and the truncation note.
+	markdownReserve = 1024
+)
+
+type markdownFamily struct {
+	name   string
+	keys   []Key
+	counts map[Status]int
+	worst  Status
+}
+
+// markdownBuilder builds the report up to the maximum length of a GitHub comment. Once a table row doesn't fit, it
+// and all further rows are omitted and counted.
+type markdownBuilder struct {
+	strings.Builder
+	omitted int
+}
+
+func (b *markdownBuilder) printf(format string, args ...interface{}) {
+	_, _ = fmt.Fprintf(&b.Builder, format, args...)
+}
+
+func (b *markdownBuilder) row(format string, args ...interface{}) {
+	row := fmt.Sprintf(format, args...)
+	if b.omitted > 0 || b.Len()+len(row)+markdownReserve > markdownMaxLength {
+		b.omitted++
+		return
+	}
+	b.WriteString(row)
+}
+
+// writeMarkdown writes a report meant to be posted as a pull request comment: a summary followed by one collapsible
+// table per metric family with warnings or errors, listing only those series, with the families and series sorted by
+// severity. Added and removed series are listed as well. The report is truncated to fit a GitHub comment.
+func (c *Comparison) writeMarkdown(w io.Writer) error {
+	families := groupMarkdownFamilies(c.Keys, c.Deltas)
+
+	total := make(map[Status]int)
+	for _, f := range families {
+		for status, count := range f.counts {
+			total[status] += count
+		}
+	}
+
+	b := &markdownBuilder{}
+	b.printf("## Metrics comparison\n\n")
+	b.printf("| %s Errors | %s Warnings | %s Improvements | %s Insufficient data | ➕ Added | ➖ Removed | Compared |\n",
+		statusMarkers[StatusError], statusMarkers[StatusWarn], statusMarkers[StatusImprovement], statusMarkers[StatusInsufficientData])
+	b.printf("|---:|---:|---:|---:|---:|---:|---:|\n")
+	b.printf("| %s | %s | %d | %d | %d | %d | %d |\n\n",
+		markdownCount(total[StatusError]), markdownCount(total[StatusWarn]), total[StatusImprovement], total[StatusInsufficientData],
+		len(c.Added), len(c.Removed), len(c.Keys))
+	if unlisted := len(c.Keys) - total[StatusError] - total[StatusWarn]; unlisted > 0 {
+		b.printf("%d series without warnings or errors are not listed.\n\n", unlisted)
+	}
+
+	for _, f := range families {
+		listed := f.counts[StatusError] + f.counts[StatusWarn]
+		if listed == 0 {
+			continue
+		}
+		if b.omitted > 0 {
+			b.omitted += listed
+			continue
+		}
+		var summaryParts []string
+		for _, status := range []Status{StatusError, StatusWarn, StatusImprovement, StatusInsufficientData} {
+			if f.counts[status] > 0 {
+				summaryParts = append(summaryParts, fmt.Sprintf("%d %s", f.counts[status], status))
+			}
+		}
+		summary := strings.Join(summaryParts, ", ") + fmt.Sprintf(" of %d series", len(f.keys))
+
+		b.printf("<details open>\n<summary>%s <code>%s</code>: %s</summary>\n\n", statusMarkers[f.worst], f.name, summary)
+		b.printf("| | Labels | Baseline | New | Change | Rule |\n")
+		b.printf("|---|---|---:|---:|---:|---|\n")
+		for _, k := range f.keys {
+			delta := c.Deltas[k]
+			status := delta.Status()
+			if status != StatusError && status != StatusWarn {
+				continue
+			}
+			change := "n/a"
+			if c.Old[k].Value != 0 {
+				change = fmt.Sprintf("**%+0.2f%%%s**", delta.PercentChange, delta.statisticsSuffix())
+			}
+			b.row("| %s | %s | %s | %s | %s | %s |\n", statusMarkers[status], markdownEscape(k.Labels),
+				c.Old[k].String(), c.New[k].String(), change, markdownEscape(delta.FiredRule()))
+		}
+		b.printf("\n</details>\n\n")
+	}
+
+	writeMarkdownSeries(b, "➕ Added series", "New", c.Added, c.New)
+	writeMarkdownSeries(b, "➖ Removed series", "Baseline", c.Removed, c.Old)
+	if b.omitted > 0 {
+		b.printf("_Truncated to fit a GitHub comment, %d more series are not shown. Use `--format html-table` or `csv` for the full report._\n", b.omitted)
+	}
+
+	ew := &errWriter{w: w}
+	ew.printf("%s", b.String())
+	return ew.err
+}
+
+func writeMarkdownSeries(b *markdownBuilder, title, valueHeader string, keys []Key, m Map) {
+	if len(keys) == 0 {
+		return
+	}
+	if b.omitted > 0 {
+		b.omitted += len(keys)
+		return
+	}
+	b.printf("<details>\n<summary>%s (%d)</summary>\n\n", title, len(keys))
+	b.printf("| Metric | Labels | %s |\n", valueHeader)
+	b.printf("|---|---|---:|\n")
+	for _, k := range keys {
+		b.row("| `%s` | %s | %s |\n", k.Metric, markdownEscape(k.Labels), m[k].String())
+	}
+	b.printf("\n</details>\n\n")
+}
+
+func groupMarkdownFamilies(keys []Key, deltas map[Key]Delta) []*markdownFamily {
+	byName := make(map[string]*markdownFamily)
+	var families []*markdownFamily
+	for _, k := range keys {
+		f, ok := byName[k.Metric]
+		if !ok {
+			f = &markdownFamily{name: k.Metric, counts: make(map[Status]int), worst: StatusOK}
+			byName[k.Metric] = f
+			families = append(families, f)
+		}
+		status := deltas[k].Status()
+		f.keys = append(f.keys, k)
+		f.counts[status]++
+		if severity[status] > severity[f.worst] {
+			f.worst = status
+		}
+	}
+
+	for _, f := range families {
+		sort.SliceStable(f.keys, func(i, j int) bool {
+			return severity[deltas[f.keys[i]].Status()] > severity[deltas[f.keys[j]].Status()]
+		})
+	}
+	sort.SliceStable(families, func(i, j int) bool {
+		if severity[families[i].worst] != severity[families[j].worst] {
+			return severity[families[i].worst] > severity[families[j].worst]
+		}
+		return families[i].counts[families[i].worst] > families[j].counts[families[j].worst]
+	})
+	return families
+}
+
+func markdownCount(count int) string {
+	if count == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("**%d**", count)
+}
+
+func markdownEscape(s string) string {
+	return strings.ReplaceAll(s, "|", "\\|")
+}
@@ -0,0 +1,173 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/prom2json"
+)
+
+const maxLineLength = 16 * 1024 * 1024
+
+// ParseError is a parse error of the Prometheus text format with the line number relative to the whole input.
+type ParseError struct {
+	Line int
+	Text string
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s: %q", e.Line, e.Msg, e.Text)
+}
+
+// chunk is a contiguous part of the input containing the samples of a single metric family.
+type chunk struct {
+	name      string
+	startLine int
+	lines     []string
+}
+
+// Parse parses the Prometheus text format from in. The input is split into one chunk per metric family and
+// each chunk is parsed on its own, so in lenient mode a malformed family is dropped instead of failing the whole input.
+// A family repeated after other families is an error, in lenient mode its samples are merged into the first one.
+// It returns the parsed families and the errors of the dropped families.
+func Parse(in io.Reader, lenient bool) ([]*prom2json.Family, []error, error) {
+	var (
+		parser   expfmt.TextParser
+		families []*prom2json.Family
+		dropped  []error
+		current  chunk
+		// seen are the index in families and the first line of each family.
+		seen = make(map[string][2]int)
+	)
+
+	flush := func() error {
+		defer func() {
+			current = chunk{}
+		}()
+		if len(current.lines) == 0 {
+			return nil
+		}
+		parsed, err := parser.TextToMetricFamilies(strings.NewReader(strings.Join(current.lines, "")))
+		if err != nil {
+			err = current.wrapError(err)
+			if !lenient {
+				return err
+			}
+			dropped = append(dropped, err)
+			return nil
+		}
+		names := make([]string, 0, len(parsed))
+		for name := range parsed {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			family := prom2json.NewFamily(parsed[name])
+			first, ok := seen[name]
+			if !ok {
+				seen[name] = [2]int{len(families), current.startLine}
+				families = append(families, family)
+				continue
+			}
+			err := current.repeatedError(name, first[1])
+			if !lenient {
+				return err
+			}
+			// Samples repeated without a TYPE line are untyped.
+			if existing := families[first[0]]; existing.Type == family.Type || family.Type == "UNTYPED" {
+				existing.Metrics = append(existing.Metrics, family.Metrics...)
+			} else {
+				dropped = append(dropped, errors.Wrapf(err, "type %s differs from %s", family.Type, existing.Type))
+			}
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		if name, ok := familyNameOfLine(line); ok && !current.contains(name) {
+			if err := flush(); err != nil {
+				return nil, nil, err
+			}
+			current.name = name
+		}
+		if len(current.lines) == 0 {
+			current.startLine = lineNumber
+		}
+		current.lines = append(current.lines, line+"\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, nil, err
+	}
+	return families, dropped, nil
+}
+
+// familyNameOfLine returns the metric name a line of the text format refers to. Comments other than HELP and TYPE
+// as well as empty lines do not refer to any metric.
+func familyNameOfLine(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return "", false
+	}
+	if strings.HasPrefix(line, "#") {
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && (fields[1] == "HELP" || fields[1] == "TYPE") {
+			return fields[2], true
+		}
+		return "", false
+	}
+	if end := strings.IndexAny(line, "{ \t"); end > 0 {
+		return line[:end], true
+	}
+	return line, true
+}
+
+func (c *chunk) contains(name string) bool {
+	if c.name == "" {
+		return false
+	}
+	if name == c.name {
+		return true
+	}
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		if name == c.name+suffix {
+			return true
+		}
+	}
+	return false
+}
+
+// repeatedError returns the error of a chunk repeating a family first seen on firstLine.
+func (c *chunk) repeatedError(name string, firstLine int) error {
+	return &ParseError{
+		Line: c.startLine,
+		Text: strings.TrimSuffix(c.lines[0], "\n"),
+		Msg:  fmt.Sprintf("metric family %s repeated, first seen on line %d", name, firstLine),
+	}
+}
+
+func (c *chunk) wrapError(err error) error {
+	var textErr expfmt.ParseError
+	if !errors.As(err, &textErr) {
+		return err
+	}
+	result := &ParseError{
+		Line: c.startLine + textErr.Line - 1,
+		Msg:  textErr.Msg,
+	}
+	if idx := textErr.Line - 1; idx >= 0 && idx < len(c.lines) {
+		result.Text = strings.TrimSuffix(c.lines[idx], "\n")
+	}
+	return result
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const malformedMetrics = `# HELP first_total A counter.
+# TYPE first_total counter
+first_total{Op="Get"} 1
+# HELP broken_total A counter exported by a flaky exporter.
+# TYPE broken_total counter
+broken_total{Op="Get"} not-a-number
+# HELP duration A histogram.
+# TYPE duration histogram
+duration_bucket{le="1"} 1
+duration_bucket{le="+Inf"} 2
+duration_sum 3
+duration_count 2
+untyped_metric 4
+`
+
+func TestParse(t *testing.T) {
+	t.Run("strict", func(t *testing.T) {
+		_, _, err := Parse(strings.NewReader(malformedMetrics), false)
+		require.Error(t, err)
+		assert.Equal(t, `line 6: expected float as value, got "not-a-number": "broken_total{Op=\"Get\"} not-a-number"`, err.Error())
+	})
+
+	t.Run("lenient", func(t *testing.T) {
+		families, dropped, err := Parse(strings.NewReader(malformedMetrics), true)
+		require.NoError(t, err)
+		require.Len(t, dropped, 1)
+		assert.Contains(t, dropped[0].Error(), "line 6")
+
+		var names []string
+		for _, family := range families {
+			names = append(names, family.Name)
+		}
+		assert.Equal(t, []string{"first_total", "duration", "untyped_metric"}, names)
+	})
+}
+
+const repeatedMetrics = `# TYPE first_total counter
+first_total{Op="Get"} 1
+# TYPE second_total counter
+second_total 2
+first_total{Op="Upsert"} 3
+# TYPE second_total gauge
+second_total 4
+`
+
+func TestParse_repeatedFamily(t *testing.T) {
+	t.Run("strict", func(t *testing.T) {
+		_, _, err := Parse(strings.NewReader(repeatedMetrics), false)
+		require.Error(t, err)
+		assert.Equal(t, `line 5: metric family first_total repeated, first seen on line 1: "first_total{Op=\"Upsert\"} 3"`, err.Error())
+	})
+
+	t.Run("lenient", func(t *testing.T) {
+		families, dropped, err := Parse(strings.NewReader(repeatedMetrics), true)
+		require.NoError(t, err)
+		require.Len(t, families, 2)
+		assert.Equal(t, "first_total", families[0].Name)
+		assert.Len(t, families[0].Metrics, 2, "samples are merged")
+		assert.Len(t, families[1].Metrics, 1)
+		require.Len(t, dropped, 1)
+		assert.Contains(t, dropped[0].Error(), "line 6: metric family second_total repeated")
+	})
+}
+
+func TestReadFile_parseError(t *testing.T) {
+	_, _, err := ReadFile("testdata/sample.txt", InputOptions{})
+	require.NoError(t, err)
+
+	_, _, err = ReadFile("parse_test.go", InputOptions{})
+	assert.ErrorContains(t, err, "error parsing parse_test.go: line 1:")
+}
@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Rates calculates the per second rates of the counters between two snapshots of the same process taken interval
+// apart. Histograms and summaries are turned into the mean of the observations made during the interval, and
+// histograms additionally into the quantiles calculated from the bucket deltas. Gauges are taken from the later
+// snapshot as is, while summary quantiles cannot be calculated for the interval and are dropped.
+//
+// A value lower than in the earlier snapshot is treated as a counter reset, i.e. the process restarted during the
+// interval, in which case the later value is the increase. Series only present in the later snapshot are assumed to
+// have started at 0, series only present in the earlier snapshot are dropped.
+// The snapshots are expected to be converted without quantiles or minimum histogram count, which are applied to the
+// interval by opts instead, along with the selectors.
+func Rates(earlier, later Map, interval time.Duration, opts Options) (Map, error) {
+	if interval <= 0 {
+		return nil, errors.Errorf("interval must be positive, got %s", interval)
+	}
+	seconds := interval.Seconds()
+
+	rates := make(Map)
+	for k, s := range later {
+		if s.Family == nil {
+			continue
+		}
+		included := opts.includes(s.Family, s.Labels)
+		prev, hasPrev := earlier[k]
+		switch s.Family.Type {
+		case "COUNTER":
+			if !included {
+				continue
+			}
+			increase := s.Value
+			if hasPrev && s.Value >= prev.Value {
+				increase -= prev.Value
+			}
+			s.Value = increase / seconds
+			rates[k] = s
+		case "GAUGE":
+			if included {
+				rates[k] = s
+			}
+		case "HISTOGRAM", "SUMMARY":
+			if _, isQuantile := s.Labels[QuantileLabel]; isQuantile {
+				continue
+			}
+			if hasPrev && !isReset(prev, s) {
+				s.Sum -= prev.Sum
+				s.Count -= prev.Count
+				s.Buckets = subtractBuckets(s.Buckets, prev.Buckets)
+			}
+			if s.Count == 0 || s.Count < float64(opts.MinHistogramCount) {
+				continue
+			}
+			s.Value = s.Sum / s.Count
+			if included {
+				rates[k] = s
+			}
+
+			if s.Family.Type != "HISTOGRAM" {
+				continue
+			}
+			for _, q := range opts.Quantiles {
+				labels := withQuantile(s.Labels, FormatQuantile(q))
+				if !opts.includes(s.Family, labels) {
+					continue
+				}
+				rates[Key{
+					Metric: k.Metric,
+					Labels: labels.String(),
+				}] = Series{
+					Name:   s.Name,
+					Labels: labels,
+					Value:  HistogramQuantile(q, s.Buckets, s.Count),
+					Sum:    s.Sum,
+					Count:  s.Count,
+					Family: s.Family,
+				}
+			}
+		}
+	}
+	return rates, nil
+}
+
+// isReset returns whether the histogram or summary was reset between the earlier and later snapshot.
+func isReset(earlier, later Series) bool {
+	if later.Count < earlier.Count {
+		return true
+	}
+	for i := range later.Buckets {
+		if i < len(earlier.Buckets) && earlier.Buckets[i].UpperBound == later.Buckets[i].UpperBound &&
+			later.Buckets[i].Count < earlier.Buckets[i].Count {
+			return true
+		}
+	}
+	return false
+}
+
+// subtractBuckets returns the counts of the buckets b minus those of a with the same upper bound.
+func subtractBuckets(b, a []Bucket) []Bucket {
+	result := make([]Bucket, len(b))
+	copy(result, b)
+	j := 0
+	for i := range result {
+		for j < len(a) && a[j].UpperBound < result[i].UpperBound {
+			j++
+		}
+		if j < len(a) && a[j].UpperBound == result[i].UpperBound {
+			result[i].Count -= a[j].Count
+		}
+	}
+	return result
+}
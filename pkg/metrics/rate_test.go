@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prom2json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRates(t *testing.T) {
+	counter := &prom2json.Family{Type: "COUNTER"}
+	gauge := &prom2json.Family{Type: "GAUGE"}
+	histogram := &prom2json.Family{Type: "HISTOGRAM"}
+	summary := &prom2json.Family{Type: "SUMMARY"}
+
+	requests := Key{Metric: "requests_total"}
+	restarted := Key{Metric: "restarted_total"}
+	created := Key{Metric: "created_total"}
+	goroutines := Key{Metric: "goroutines"}
+	duration := Key{Metric: "duration"}
+	gc := Key{Metric: "gc_duration"}
+	gcQuantile := Key{Metric: "gc_duration", Labels: "quantile=0.5"}
+	p50 := Key{Metric: "duration", Labels: "quantile=0.5"}
+	removed := Key{Metric: "removed_total"}
+
+	earlier := Map{
+		requests:   {Value: 1000, Family: counter},
+		restarted:  {Value: 1000, Family: counter},
+		goroutines: {Value: 50, Family: gauge},
+		duration:   {Sum: 100, Count: 100, Buckets: []Bucket{{1, 50}, {2, 100}}, Family: histogram},
+		gc:         {Sum: 10, Count: 10, Family: summary},
+		gcQuantile: {Labels: Labels{QuantileLabel: "0.5"}, Value: 1, Family: summary},
+		removed:    {Value: 1, Family: counter},
+	}
+	later := Map{
+		requests:   {Value: 1600, Family: counter},
+		restarted:  {Value: 30, Family: counter},
+		created:    {Value: 60, Family: counter},
+		goroutines: {Value: 70, Family: gauge},
+		duration:   {Sum: 400, Count: 200, Buckets: []Bucket{{1, 50}, {2, 200}}, Family: histogram},
+		gc:         {Sum: 40, Count: 20, Family: summary},
+		gcQuantile: {Labels: Labels{QuantileLabel: "0.5"}, Value: 2, Family: summary},
+	}
+
+	rates, err := Rates(earlier, later, time.Minute, Options{Quantiles: []float64{0.5}})
+	require.NoError(t, err)
+
+	assert.Equal(t, 10.0, rates[requests].Value)
+	assert.Equal(t, 0.5, rates[restarted].Value, "counter reset")
+	assert.Equal(t, 1.0, rates[created].Value, "new series start at 0")
+	assert.Equal(t, 70.0, rates[goroutines].Value, "gauges are taken as is")
+	assert.Equal(t, 3.0, rates[duration].Value, "mean of the interval")
+	assert.Equal(t, 100.0, rates[duration].Count)
+	assert.Equal(t, []Bucket{{1, 0}, {2, 100}}, rates[duration].Buckets)
+	assert.Equal(t, 1.5, rates[p50].Value, "quantile of the bucket deltas")
+	assert.Equal(t, 3.0, rates[gc].Value)
+	assert.NotContains(t, rates, gcQuantile, "summary quantiles are dropped")
+	assert.Len(t, rates, 7)
+
+	rates, err = Rates(earlier, later, time.Minute, Options{MinHistogramCount: 101})
+	require.NoError(t, err)
+	assert.NotContains(t, rates, duration, "the minimum count applies to the interval")
+
+	_, err = Rates(earlier, later, 0, Options{})
+	assert.Error(t, err)
+}
+
+func TestRates_histogramReset(t *testing.T) {
+	histogram := &prom2json.Family{Type: "HISTOGRAM"}
+	k := Key{Metric: "duration"}
+	earlier := Map{k: {Sum: 100, Count: 100, Buckets: []Bucket{{1, 50}, {2, 100}}, Family: histogram}}
+	later := Map{k: {Sum: 30, Count: 10, Buckets: []Bucket{{1, 5}, {2, 10}}, Family: histogram}}
+
+	rates, err := Rates(earlier, later, time.Minute, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, 3.0, rates[k].Value)
+	assert.Equal(t, later[k].Buckets, rates[k].Buckets)
+}
@@ -0,0 +1,227 @@
+package metrics
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// nameLabel is the pseudo label selecting the metric name, as in Prometheus.
+const nameLabel = "__name__"
+
+// MatchType is the comparison of a label matcher.
+type MatchType string
+
+const (
+	MatchEqual     MatchType = "="
+	MatchNotEqual  MatchType = "!="
+	MatchRegexp    MatchType = "=~"
+	MatchNotRegexp MatchType = "!~"
+)
+
+// Matcher matches the value of a single label.
+type Matcher struct {
+	Name  string
+	Type  MatchType
+	Value string
+
+	re *regexp.Regexp
+}
+
+// NewMatcher creates a matcher. Regular expressions are fully anchored.
+func NewMatcher(name string, t MatchType, value string) (*Matcher, error) {
+	m := &Matcher{Name: name, Type: t, Value: value}
+	switch t {
+	case MatchEqual, MatchNotEqual:
+	case MatchRegexp, MatchNotRegexp:
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid regex %q for label %s", value, name)
+		}
+		m.re = re
+	default:
+		return nil, errors.Errorf("unknown match type %q", t)
+	}
+	return m, nil
+}
+
+// Matches returns whether the label value matches. An absent label has the empty value.
+func (m *Matcher) Matches(value string) bool {
+	switch m.Type {
+	case MatchEqual:
+		return value == m.Value
+	case MatchNotEqual:
+		return value != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(value)
+	case MatchNotRegexp:
+		return !m.re.MatchString(value)
+	default:
+		return false
+	}
+}
+
+func (m *Matcher) String() string {
+	return m.Name + string(m.Type) + strconv.Quote(m.Value)
+}
+
+// Selector selects series by their metric name and labels like a Prometheus instant vector selector, e.g.
+// rox_central_postgres_op_duration{Op="Get",Type=~"Deployment|Pod"} or {__name__=~"go_.*",quantile!="0.5"}.
+// The metric name is matched against the full family name, without a trimmed prefix.
+type Selector struct {
+	Matchers []*Matcher
+}
+
+// ParseSelector parses a Prometheus style selector.
+func ParseSelector(s string) (*Selector, error) {
+	p := &selectorParser{input: s}
+	selector, err := p.parse()
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid selector %q", s)
+	}
+	return selector, nil
+}
+
+// Matches returns whether the series of the family with the given name and labels is selected.
+func (s *Selector) Matches(name string, labels Labels) bool {
+	for _, m := range s.Matchers {
+		value := labels[m.Name]
+		if m.Name == nameLabel {
+			value = name
+		}
+		if !m.Matches(value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Selector) String() string {
+	parts := make([]string, 0, len(s.Matchers))
+	for _, m := range s.Matchers {
+		parts = append(parts, m.String())
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+type selectorParser struct {
+	input string
+	pos   int
+}
+
+func (p *selectorParser) parse() (*Selector, error) {
+	selector := &Selector{}
+	p.skipSpace()
+	if name := p.identifier(); name != "" {
+		selector.Matchers = append(selector.Matchers, &Matcher{Name: nameLabel, Type: MatchEqual, Value: name})
+	}
+	p.skipSpace()
+	if p.consume("{") {
+		for {
+			p.skipSpace()
+			if p.consume("}") {
+				break
+			}
+			matcher, err := p.matcher()
+			if err != nil {
+				return nil, err
+			}
+			selector.Matchers = append(selector.Matchers, matcher)
+			p.skipSpace()
+			if p.consume("}") {
+				break
+			}
+			if !p.consume(",") {
+				return nil, errors.Errorf("expected , or } at position %d", p.pos)
+			}
+		}
+	}
+	p.skipSpace()
+	if p.pos != len(p.input) {
+		return nil, errors.Errorf("unexpected %q at position %d", p.input[p.pos:], p.pos)
+	}
+	if len(selector.Matchers) == 0 {
+		return nil, errors.New("a metric name or label matcher is required")
+	}
+	return selector, nil
+}
+
+func (p *selectorParser) matcher() (*Matcher, error) {
+	name := p.identifier()
+	if name == "" {
+		return nil, errors.Errorf("expected label name at position %d", p.pos)
+	}
+	p.skipSpace()
+	var t MatchType
+	for _, candidate := range []MatchType{MatchRegexp, MatchNotRegexp, MatchNotEqual, MatchEqual} {
+		if p.consume(string(candidate)) {
+			t = candidate
+			break
+		}
+	}
+	if t == "" {
+		return nil, errors.Errorf("expected =, !=, =~ or !~ after %s at position %d", name, p.pos)
+	}
+	p.skipSpace()
+	value, err := p.quoted()
+	if err != nil {
+		return nil, err
+	}
+	return NewMatcher(name, t, value)
+}
+
+func (p *selectorParser) identifier() string {
+	start := p.pos
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+		if c == '_' || c == ':' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || p.pos > start && c >= '0' && c <= '9' {
+			p.pos++
+			continue
+		}
+		break
+	}
+	return p.input[start:p.pos]
+}
+
+// quoted parses a double quoted or backtick quoted string with Go escaping.
+func (p *selectorParser) quoted() (string, error) {
+	if p.pos >= len(p.input) || (p.input[p.pos] != '"' && p.input[p.pos] != '`') {
+		return "", errors.Errorf("expected quoted label value at position %d", p.pos)
+	}
+	quote := p.input[p.pos]
+	end := p.pos + 1
+	for ; end < len(p.input); end++ {
+		if quote == '"' && p.input[end] == '\\' {
+			end++
+			continue
+		}
+		if p.input[end] == quote {
+			break
+		}
+	}
+	if end >= len(p.input) {
+		return "", errors.Errorf("unterminated label value at position %d", p.pos)
+	}
+	value, err := strconv.Unquote(p.input[p.pos : end+1])
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid label value at position %d", p.pos)
+	}
+	p.pos = end + 1
+	return value, nil
+}
+
+func (p *selectorParser) consume(token string) bool {
+	if strings.HasPrefix(p.input[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *selectorParser) skipSpace() {
+	for p.pos < len(p.input) && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t') {
+		p.pos++
+	}
+}
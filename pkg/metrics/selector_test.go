@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSelector(t *testing.T) {
+	for _, tt := range []struct {
+		selector string
+		expected string
+	}{
+		{selector: "rox_central_postgres_op_duration", expected: `{__name__="rox_central_postgres_op_duration"}`},
+		{selector: `rox_central_postgres_op_duration{Op="Get",Type=~"Deployment|Pod"}`, expected: `{__name__="rox_central_postgres_op_duration",Op="Get",Type=~"Deployment|Pod"}`},
+		{selector: ` { __name__ =~ "go_.*" , quantile != "0.5", } `, expected: `{__name__=~"go_.*",quantile!="0.5"}`},
+		{selector: "{Type!~`Pod|Node`}", expected: `{Type!~"Pod|Node"}`},
+		{selector: `{Path="a\"b"}`, expected: `{Path="a\"b"}`},
+	} {
+		t.Run(tt.selector, func(t *testing.T) {
+			selector, err := ParseSelector(tt.selector)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, selector.String())
+		})
+	}
+
+	for _, invalid := range []string{"", "{}", "foo{", `foo{Op}`, `foo{Op=Get}`, `foo{Op="Get"`, `foo{Op=~"("}`, `foo bar`, `foo{Op=="Get"}`} {
+		t.Run(invalid, func(t *testing.T) {
+			_, err := ParseSelector(invalid)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSelector_Matches(t *testing.T) {
+	selector, err := ParseSelector(`rox_central_postgres_op_duration{Op="Get",Type=~"Deployment|Pod",Error!="true"}`)
+	require.NoError(t, err)
+
+	assert.True(t, selector.Matches("rox_central_postgres_op_duration", Labels{"Op": "Get", "Type": "Pod"}))
+	assert.False(t, selector.Matches("rox_central_postgres_op_duration", Labels{"Op": "Get", "Type": "PodSpec"}), "regexes are anchored")
+	assert.False(t, selector.Matches("rox_central_postgres_op_duration", Labels{"Op": "Get", "Type": "Pod", "Error": "true"}))
+	assert.False(t, selector.Matches("postgres_op_duration", Labels{"Op": "Get", "Type": "Pod"}), "the full name is matched")
+
+	selector, err = ParseSelector(`{Type=""}`)
+	require.NoError(t, err)
+	assert.True(t, selector.Matches("any", Labels{}), "absent labels are empty")
+}
+
+func TestToSeries_selectors(t *testing.T) {
+	f, err := os.Open("testdata/sample.txt")
+	require.NoError(t, err)
+	defer func() {
+		_ = f.Close()
+	}()
+	families, _, err := Parse(f, false)
+	require.NoError(t, err)
+
+	selector, err := ParseSelector(`{__name__=~"go_gc_duration_seconds|go_goroutines"}`)
+	require.NoError(t, err)
+	exclude, err := ParseSelector(`{quantile=~"0|1"}`)
+	require.NoError(t, err)
+
+	m, err := ToSeries(families, Options{Select: []*Selector{selector}, Exclude: []*Selector{exclude}})
+	require.NoError(t, err)
+
+	var keys []string
+	for _, k := range m.SortedKeys() {
+		keys = append(keys, k.Metric+" "+k.Labels)
+	}
+	assert.Equal(t, []string{
+		"go_gc_duration_seconds ",
+		"go_gc_duration_seconds quantile=0.25",
+		"go_gc_duration_seconds quantile=0.5",
+		"go_gc_duration_seconds quantile=0.75",
+		"go_goroutines ",
+	}, keys)
+}
@@ -0,0 +1,289 @@
+// Package metrics parses Prometheus metric dumps into series, compares them and writes them in various formats.
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/prom2json"
+)
+
+// Labels are the label names and values of a series.
+type Labels map[string]string
+
+// String returns the labels as space separated name=value pairs sorted by name.
+func (l Labels) String() string {
+	var keys []string
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	sb := strings.Builder{}
+	for _, k := range keys {
+		sb.WriteString(fmt.Sprintf("%s=%s ", k, l[k]))
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// Key identifies a series by its metric name and labels.
+type Key struct {
+	Metric string
+	Labels string
+}
+
+// Series is a single value of a metric family. For histograms and summaries the value is the mean of the
+// observations, or the quantile given by the quantile label.
+type Series struct {
+	Name       string
+	Labels     Labels
+	Value      float64
+	Sum, Count float64
+	Buckets    []Bucket
+	Family     *prom2json.Family
+	// Baseline is the spread of the value if the series was merged from multiple runs, see MergeBaselines.
+	Baseline *Baseline
+}
+
+func (s Series) String() string {
+	var value string
+	if s.Count != 0 {
+		value = fmt.Sprintf("(%0.2f/%d) %0.2f", s.Sum, int64(s.Count), s.Value)
+	} else {
+		value = fmt.Sprintf("%0.2f", s.Value)
+	}
+	if s.Baseline != nil {
+		value += " " + s.Baseline.String()
+	}
+	return value
+}
+
+// HasObservations returns whether the series is calculated from a number of observations, i.e. is a histogram or summary.
+func (s Series) HasObservations() bool {
+	return s.Family != nil && (s.Family.Type == "HISTOGRAM" || s.Family.Type == "SUMMARY")
+}
+
+// Map holds the series by their key.
+type Map map[Key]Series
+
+// SortedKeys returns the keys of the map sorted by metric name and labels.
+func (m Map) SortedKeys() []Key {
+	var keys []Key
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	SortKeys(keys)
+	return keys
+}
+
+// SortKeys sorts keys by metric name and labels.
+func SortKeys(keys []Key) {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Metric != keys[j].Metric {
+			return keys[i].Metric < keys[j].Metric
+		}
+		return keys[i].Labels < keys[j].Labels
+	})
+}
+
+// Options control how metric families are turned into series.
+type Options struct {
+	// MinHistogramCount is the minimum number of observations for a histogram or summary to be included.
+	MinHistogramCount int
+	// TrimPrefix is removed from the metric names.
+	TrimPrefix string
+	// Quantiles are calculated from the histogram buckets in addition to the mean.
+	Quantiles []float64
+	// Select only includes the series matched by any of the selectors, if set.
+	Select []*Selector
+	// Exclude drops the series matched by any of the selectors.
+	Exclude []*Selector
+	// Aggregate merges the selected series per group before the minimum histogram count and quantiles are applied.
+	Aggregate *Aggregation
+}
+
+// includes returns whether the series of the family with the given labels is selected.
+func (opts Options) includes(family *prom2json.Family, labels Labels) bool {
+	name := ""
+	if family != nil {
+		name = family.Name
+	}
+	for _, s := range opts.Exclude {
+		if s.Matches(name, labels) {
+			return false
+		}
+	}
+	if len(opts.Select) == 0 {
+		return true
+	}
+	for _, s := range opts.Select {
+		if s.Matches(name, labels) {
+			return true
+		}
+	}
+	return false
+}
+
+// add adds the series to the map if it is selected by the options.
+func (m Map) add(s Series, opts Options) {
+	if !opts.includes(s.Family, s.Labels) {
+		return
+	}
+	m[Key{Metric: s.Name, Labels: s.Labels.String()}] = s
+}
+
+// Filter returns the families with the given names. All families are returned if no names are given.
+func Filter(families []*prom2json.Family, names []string) []*prom2json.Family {
+	if len(names) == 0 {
+		return families
+	}
+	desiredMetrics := make(map[string]struct{})
+	for _, name := range names {
+		desiredMetrics[name] = struct{}{}
+	}
+
+	var result []*prom2json.Family
+	for _, family := range families {
+		if _, ok := desiredMetrics[family.Name]; ok {
+			result = append(result, family)
+		}
+	}
+	return result
+}
+
+// ToSeries turns the metric families into series. Counters and gauges are taken as is, while histograms and
+// summaries are aggregated into their mean plus one series per quantile. Other family types are ignored.
+// If an aggregation is set, the selectors apply to the series before they are aggregated, and their quantile
+// matchers to the aggregated series together with the other matchers of labels which are kept.
+func ToSeries(families []*prom2json.Family, opts Options) (Map, error) {
+	if opts.Aggregate != nil {
+		before, after, err := opts.Aggregate.SplitSelectors(opts)
+		if err != nil {
+			return nil, err
+		}
+		m, err := ToSeries(families, before)
+		if err != nil {
+			return nil, err
+		}
+		aggregated := opts.Aggregate.Apply(m, opts)
+		for k, series := range aggregated {
+			if !after.includes(series.Family, series.Labels) {
+				delete(aggregated, k)
+			}
+		}
+		return aggregated, nil
+	}
+
+	metricMap := make(Map)
+	for _, family := range families {
+		metricName := strings.TrimPrefix(family.Name, opts.TrimPrefix)
+
+		switch family.Type {
+		case "HISTOGRAM":
+			for _, familyMetric := range family.Metrics {
+				histogram := familyMetric.(prom2json.Histogram)
+				count, err := strconv.ParseFloat(histogram.Count, 64)
+				if err != nil {
+					return nil, err
+				}
+				if count < float64(opts.MinHistogramCount) {
+					continue
+				}
+
+				sum, err := strconv.ParseFloat(histogram.Sum, 64)
+				if err != nil {
+					return nil, err
+				}
+
+				buckets, err := parseBuckets(histogram.Buckets)
+				if err != nil {
+					return nil, err
+				}
+
+				metricMap.add(Series{
+					Name:    metricName,
+					Labels:  histogram.Labels,
+					Value:   sum / count,
+					Sum:     sum,
+					Count:   count,
+					Buckets: buckets,
+					Family:  family,
+				}, opts)
+
+				for _, q := range opts.Quantiles {
+					labels := withQuantile(histogram.Labels, FormatQuantile(q))
+					metricMap.add(Series{
+						Name:   metricName,
+						Labels: labels,
+						Value:  HistogramQuantile(q, buckets, count),
+						Sum:    sum,
+						Count:  count,
+						Family: family,
+					}, opts)
+				}
+			}
+		case "SUMMARY":
+			for _, familyMetric := range family.Metrics {
+				summary := familyMetric.(prom2json.Summary)
+				count, err := strconv.ParseFloat(summary.Count, 64)
+				if err != nil {
+					return nil, err
+				}
+				if count < float64(opts.MinHistogramCount) {
+					continue
+				}
+
+				sum, err := strconv.ParseFloat(summary.Sum, 64)
+				if err != nil {
+					return nil, err
+				}
+
+				metricMap.add(Series{
+					Name:   metricName,
+					Labels: summary.Labels,
+					Value:  sum / count,
+					Sum:    sum,
+					Count:  count,
+					Family: family,
+				}, opts)
+
+				for quantile, rawValue := range summary.Quantiles {
+					value, err := strconv.ParseFloat(rawValue, 64)
+					if err != nil {
+						return nil, err
+					}
+					if math.IsNaN(value) {
+						continue
+					}
+					labels := withQuantile(summary.Labels, quantile)
+					metricMap.add(Series{
+						Name:   metricName,
+						Labels: labels,
+						Value:  value,
+						Sum:    sum,
+						Count:  count,
+						Family: family,
+					}, opts)
+				}
+			}
+		case "COUNTER", "GAUGE":
+			for _, familyMetric := range family.Metrics {
+				m := familyMetric.(prom2json.Metric)
+				value, err := strconv.ParseFloat(m.Value, 64)
+				if err != nil {
+					return nil, err
+				}
+				metricMap.add(Series{
+					Name:   metricName,
+					Labels: m.Labels,
+					Value:  value,
+					Family: family,
+				}, opts)
+			}
+		}
+	}
+	return metricMap, nil
+}
@@ -0,0 +1,369 @@
+package metrics
+
+import (
+	"math"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Direction declares which changes of a value are considered a regression.
+type Direction string
+
+const (
+	DirectionAuto          Direction = "auto"
+	DirectionBoth          Direction = "both"
+	DirectionHigherIsWorse Direction = "higher-is-worse"
+	DirectionLowerIsWorse  Direction = "lower-is-worse"
+)
+
+// higherIsWorseSuffixes are the metric name suffixes of latencies and errors, which are regressions when they increase.
+var higherIsWorseSuffixes = []string{"_duration", "_seconds", "_latency", "_errors_total", "_failures_total"}
+
+// Validate returns an error if d is not a known direction.
+func (d Direction) Validate() error {
+	switch d {
+	case "", DirectionAuto, DirectionBoth, DirectionHigherIsWorse, DirectionLowerIsWorse:
+		return nil
+	default:
+		return errors.Errorf("unknown direction %q (options are %s, %s, %s or %s)", d, DirectionAuto, DirectionBoth, DirectionHigherIsWorse, DirectionLowerIsWorse)
+	}
+}
+
+// Resolve infers the direction for the series if it is auto: histograms, summaries and metrics named like latencies
+// or errors are worse when they increase, anything else is flagged in both directions.
+func (d Direction) Resolve(k Key, s Series) Direction {
+	if d != DirectionAuto {
+		return d
+	}
+	if s.HasObservations() {
+		return DirectionHigherIsWorse
+	}
+	for _, suffix := range higherIsWorseSuffixes {
+		if strings.HasSuffix(k.Metric, suffix) {
+			return DirectionHigherIsWorse
+		}
+	}
+	return DirectionBoth
+}
+
+// IsWorse returns whether a change of the value by change counts as a regression in this direction.
+func (d Direction) IsWorse(change float64) bool {
+	switch d {
+	case DirectionHigherIsWorse:
+		return change > 0
+	case DirectionLowerIsWorse:
+		return change < 0
+	default:
+		return change != 0
+	}
+}
+
+// Rule defines when the change of the matching series is reported as a warning or an error.
+// Percentages are relative to the old value, absolute deltas are in the unit of the metric. A threshold of 0 is disabled.
+// The guards MinAbsDelta and MinValue suppress warnings and errors for changes and baselines too small to be meaningful,
+// and histograms or summaries with fewer than MinCount observations on either side are reported as insufficient data.
+// Against a baseline of multiple runs, WarnZ and ErrorZ flag values this many standard deviations away from the
+// baseline mean, and OutsideRange (warn or error) flags values outside the range of the baseline values.
+// For histograms, DistributionTest compares the bucket distributions, and WarnP and ErrorP flag p-values below them.
+type Rule struct {
+	Name        string            `yaml:"name"`
+	Metric      string            `yaml:"metric"`
+	MetricRegex string            `yaml:"metricRegex"`
+	Labels      map[string]string `yaml:"labels"`
+	Warn        float64           `yaml:"warn"`
+	Error       float64           `yaml:"error"`
+	WarnAbs     float64           `yaml:"warnAbs"`
+	ErrorAbs    float64           `yaml:"errorAbs"`
+	Direction   Direction         `yaml:"direction"`
+	MinAbsDelta float64           `yaml:"minAbsDelta"`
+	MinValue    float64           `yaml:"minValue"`
+	MinCount    float64           `yaml:"minCount"`
+
+	WarnZ        float64 `yaml:"warnZ"`
+	ErrorZ       float64 `yaml:"errorZ"`
+	OutsideRange Status  `yaml:"outsideRange"`
+
+	DistributionTest DistributionTest `yaml:"distributionTest"`
+	WarnP            float64          `yaml:"warnP"`
+	ErrorP           float64          `yaml:"errorP"`
+
+	metricRegex *regexp.Regexp
+	index       int
+	isDefault   bool
+}
+
+type thresholdsConfig struct {
+	Rules []*Rule `yaml:"rules"`
+}
+
+// Thresholds holds the per metric rules and the default rule, which applies to all series not matched by any rule.
+type Thresholds struct {
+	defaultRule *Rule
+	rules       []*Rule
+}
+
+// NewThresholds creates the thresholds for the given rules. The defaults apply to all series not matched by any rule.
+// Rules which do not set MinAbsDelta, MinValue, MinCount or DistributionTest inherit them from the defaults.
+func NewThresholds(defaults Rule, rules []*Rule) (Thresholds, error) {
+	defaultRule := &defaults
+	if defaultRule.Name == "" {
+		defaultRule.Name = "default"
+	}
+	if err := defaultRule.init(0); err != nil {
+		return Thresholds{}, err
+	}
+	defaultRule.isDefault = true
+	for i, rule := range rules {
+		if err := rule.init(i); err != nil {
+			return Thresholds{}, errors.Wrapf(err, "invalid rule %d (%s)", i+1, rule)
+		}
+		if rule.MinAbsDelta == 0 {
+			rule.MinAbsDelta = defaults.MinAbsDelta
+		}
+		if rule.MinValue == 0 {
+			rule.MinValue = defaults.MinValue
+		}
+		if rule.MinCount == 0 {
+			rule.MinCount = defaults.MinCount
+		}
+		if rule.DistributionTest == "" {
+			rule.DistributionTest = defaults.DistributionTest
+		}
+	}
+	return Thresholds{
+		defaultRule: defaultRule,
+		rules:       rules,
+	}, nil
+}
+
+// LoadRules reads the rules from a yaml thresholds file.
+func LoadRules(file string) ([]*Rule, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var config thresholdsConfig
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil {
+		return nil, errors.Wrapf(err, "error decoding thresholds file %s", file)
+	}
+	for i, rule := range config.Rules {
+		if err := rule.init(i); err != nil {
+			return nil, errors.Wrapf(err, "invalid rule %d (%s) in thresholds file %s", i+1, rule, file)
+		}
+	}
+	return config.Rules, nil
+}
+
+func (r *Rule) init(index int) error {
+	r.index = index
+	if r.Metric != "" && r.MetricRegex != "" {
+		return errors.New("only one of metric and metricRegex can be specified")
+	}
+	if r.Metric != "" {
+		if _, err := path.Match(r.Metric, ""); err != nil {
+			return errors.Wrapf(err, "invalid metric glob %q", r.Metric)
+		}
+	}
+	for name, value := range r.Labels {
+		if _, err := path.Match(value, ""); err != nil {
+			return errors.Wrapf(err, "invalid glob %q for label %s", value, name)
+		}
+	}
+	if r.MetricRegex != "" {
+		re, err := regexp.Compile("^(?:" + r.MetricRegex + ")$")
+		if err != nil {
+			return errors.Wrapf(err, "invalid metric regex %q", r.MetricRegex)
+		}
+		r.metricRegex = re
+	}
+	switch r.OutsideRange {
+	case "", StatusWarn, StatusError:
+	default:
+		return errors.Errorf("unknown outsideRange %q (options are %s or %s)", r.OutsideRange, StatusWarn, StatusError)
+	}
+	if r.WarnP < 0 || r.WarnP >= 1 || r.ErrorP < 0 || r.ErrorP >= 1 {
+		return errors.New("warnP and errorP must be between 0 and 1")
+	}
+	if err := r.DistributionTest.Validate(); err != nil {
+		return err
+	}
+	if r.Direction == "" {
+		r.Direction = DirectionAuto
+	}
+	return r.Direction.Validate()
+}
+
+func (r *Rule) String() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	selector := r.Metric
+	if r.MetricRegex != "" {
+		selector = "~" + r.MetricRegex
+	}
+	if len(r.Labels) > 0 {
+		selector += "{" + Labels(r.Labels).String() + "}"
+	}
+	return selector
+}
+
+// IsDefault returns whether r is the default rule of the thresholds.
+func (r *Rule) IsDefault() bool {
+	return r.isDefault
+}
+
+// matchesName returns whether the rule matches any of the given metric names.
+func (r *Rule) matchesName(names ...string) bool {
+	for _, name := range names {
+		switch {
+		case r.metricRegex != nil:
+			if r.metricRegex.MatchString(name) {
+				return true
+			}
+		case r.Metric != "":
+			if ok, _ := path.Match(r.Metric, name); ok {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) matchesLabels(labels map[string]string) bool {
+	for name, pattern := range r.Labels {
+		value, ok := labels[name]
+		if !ok {
+			return false
+		}
+		if matched, _ := path.Match(pattern, value); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// specificity ranks how specific the metric name selector of the rule is: an exact name is more specific than a glob,
+// which is more specific than a regex, which is more specific than no name at all.
+func (r *Rule) specificity() int {
+	switch {
+	case r.metricRegex != nil:
+		return 1
+	case r.Metric != "" && strings.ContainsAny(r.Metric, `*?[\`):
+		return 2
+	case r.Metric != "":
+		return 3
+	default:
+		return 0
+	}
+}
+
+// RuleFor returns the most specific rule matching the series. Rules are ranked by the specificity of their metric name
+// selector first and the number of label selectors second. Ties are broken by the order of the rules.
+// Metric names are matched against both the trimmed series name and the full family name.
+func (t Thresholds) RuleFor(k Key, s Series) *Rule {
+	names := []string{k.Metric}
+	if s.Family != nil && s.Family.Name != k.Metric {
+		names = append(names, s.Family.Name)
+	}
+
+	var matching []*Rule
+	for _, rule := range t.rules {
+		if rule.matchesName(names...) && rule.matchesLabels(s.Labels) {
+			matching = append(matching, rule)
+		}
+	}
+	if len(matching) == 0 {
+		return t.defaultRule
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		if matching[i].specificity() != matching[j].specificity() {
+			return matching[i].specificity() > matching[j].specificity()
+		}
+		if len(matching[i].Labels) != len(matching[j].Labels) {
+			return len(matching[i].Labels) > len(matching[j].Labels)
+		}
+		return matching[i].index < matching[j].index
+	})
+	return matching[0]
+}
+
+// Evaluate calculates the delta between the old and new series according to the rule.
+// Changes exceeding the thresholds in the direction which is not worse are reported as improvements. A significant
+// change of a distribution is worse if its mean or any of its median, p90 and p99 moved in the worse direction, so a
+// regression of the tail is not hidden by a better mean.
+func (r *Rule) Evaluate(k Key, oldSeries, newSeries Series) Delta {
+	oldValue, newValue := oldSeries.Value, newSeries.Value
+	delta := Delta{
+		AbsChange: newValue - oldValue,
+		Direction: r.Direction.Resolve(k, newSeries),
+		Rule:      r,
+	}
+	if oldValue != 0 {
+		delta.PercentChange = delta.AbsChange / oldValue * 100
+	}
+	if b := oldSeries.Baseline; b != nil {
+		delta.ZScore, delta.HasZScore = b.ZScore(newValue)
+		delta.OutsideRange = !b.Contains(newValue)
+	}
+	if r.DistributionTest != "" && len(oldSeries.Buckets) > 0 && len(newSeries.Buckets) > 0 {
+		if result, ok := CompareDistributions(r.DistributionTest, oldSeries, newSeries); ok {
+			delta.Distribution = &result
+		}
+	}
+	if r.MinCount != 0 && newSeries.HasObservations() && math.Min(oldSeries.Count, newSeries.Count) < r.MinCount {
+		delta.InsufficientData = true
+		return delta
+	}
+	if math.Abs(delta.AbsChange) < r.MinAbsDelta || math.Abs(oldValue) < r.MinValue {
+		return delta
+	}
+
+	exceeds := func(status Status, percentAt, absAt, zAt, pAt float64) bool {
+		return (percentAt != 0 && oldValue != 0 && math.Abs(delta.PercentChange) > percentAt) ||
+			(absAt != 0 && math.Abs(delta.AbsChange) > absAt) ||
+			(zAt != 0 && delta.HasZScore && math.Abs(delta.ZScore) > zAt) ||
+			(r.OutsideRange == status && delta.OutsideRange) ||
+			(pAt != 0 && delta.Distribution != nil && delta.Distribution.PValue < pAt)
+	}
+	significant := func(pAt float64) bool {
+		return pAt != 0 && delta.Distribution != nil && delta.Distribution.PValue < pAt
+	}
+	isWorse := delta.Direction.IsWorse(delta.AbsChange)
+	isError := exceeds(StatusError, r.Error, r.ErrorAbs, r.ErrorZ, r.ErrorP)
+	isWarn := exceeds(StatusWarn, r.Warn, r.WarnAbs, r.WarnZ, r.WarnP)
+	distributionWorse := (significant(r.ErrorP) || significant(r.WarnP)) &&
+		distributionIsWorse(delta.Direction, oldSeries, newSeries)
+	delta.IsError = (isWorse && isError) || (distributionWorse && significant(r.ErrorP))
+	delta.IsWarn = (isWorse && isWarn) || (distributionWorse && significant(r.WarnP))
+	delta.IsImprovement = !delta.IsError && !delta.IsWarn && delta.AbsChange != 0 && (isWarn || isError)
+	return delta
+}
+
+// distributionIsWorse returns whether the mean or any of the median, p90 and p99 of the histogram moved in the worse
+// direction.
+func distributionIsWorse(direction Direction, oldSeries, newSeries Series) bool {
+	if direction.IsWorse(newSeries.Value - oldSeries.Value) {
+		return true
+	}
+	for _, q := range []float64{0.5, 0.9, 0.99} {
+		change := HistogramQuantile(q, newSeries.Buckets, newSeries.Count) - HistogramQuantile(q, oldSeries.Buckets, oldSeries.Count)
+		if !math.IsNaN(change) && direction.IsWorse(change) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/prom2json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThresholds_RuleFor(t *testing.T) {
+	rules, err := LoadRules("testdata/thresholds.yaml")
+	require.NoError(t, err)
+	thresholds, err := NewThresholds(Rule{Warn: 5, Error: 10}, rules)
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		name     string
+		key      Key
+		series   Series
+		expected string
+	}{
+		{
+			name:     "glob",
+			key:      Key{Metric: "sensor_event_duration", Labels: "Type=Deployment"},
+			series:   Series{Labels: map[string]string{"Type": "Deployment"}},
+			expected: "latencies",
+		},
+		{
+			name:     "exact name and labels win over glob",
+			key:      Key{Metric: "sensor_event_duration", Labels: "Type=Pod"},
+			series:   Series{Labels: map[string]string{"Type": "Pod"}},
+			expected: "pod events",
+		},
+		{
+			name:     "exact untrimmed family name wins over regex",
+			key:      Key{Metric: "administration_events_queue_size_total"},
+			series:   Series{Family: &prom2json.Family{Name: "rox_central_administration_events_queue_size_total"}},
+			expected: "queue size",
+		},
+		{
+			name:     "regex",
+			key:      Key{Metric: "administration_events_total"},
+			expected: "~administration_events_.*",
+		},
+		{
+			name:     "default",
+			key:      Key{Metric: "go_goroutines"},
+			expected: "default",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, thresholds.RuleFor(tt.key, tt.series).String())
+		})
+	}
+}
+
+func TestRule_Evaluate(t *testing.T) {
+	rule := &Rule{Warn: 10, Error: 20, ErrorAbs: 5, Direction: DirectionHigherIsWorse}
+
+	delta := rule.Evaluate(Key{}, Series{Value: 100}, Series{Value: 115})
+	assert.InDelta(t, 15, delta.PercentChange, 1e-9)
+	assert.True(t, delta.IsWarn)
+	assert.True(t, delta.IsError, "absolute delta exceeds errorAbs")
+
+	delta = rule.Evaluate(Key{}, Series{Value: 100}, Series{Value: 50})
+	assert.False(t, delta.IsWarn, "improvements are ignored for higher-is-worse")
+	assert.False(t, delta.IsError)
+
+	delta = rule.Evaluate(Key{}, Series{Value: 0}, Series{Value: 10})
+	assert.False(t, delta.IsWarn, "percentages are undefined for a zero baseline")
+	assert.True(t, delta.IsError)
+}
+
+func TestLoadRules_invalid(t *testing.T) {
+	_, err := LoadRules("testdata/sample.txt")
+	assert.Error(t, err)
+}
+
+func TestDirection_Resolve(t *testing.T) {
+	histogram := &prom2json.Family{Type: "HISTOGRAM"}
+	gauge := &prom2json.Family{Type: "GAUGE"}
+
+	assert.Equal(t, DirectionHigherIsWorse, DirectionAuto.Resolve(Key{Metric: "sensor_event"}, Series{Family: histogram}))
+	assert.Equal(t, DirectionHigherIsWorse, DirectionAuto.Resolve(Key{Metric: "grpc_server_handling_seconds"}, Series{Family: gauge}))
+	assert.Equal(t, DirectionHigherIsWorse, DirectionAuto.Resolve(Key{Metric: "datastore_function_duration"}, Series{}))
+	assert.Equal(t, DirectionHigherIsWorse, DirectionAuto.Resolve(Key{Metric: "pipeline_errors_total"}, Series{}))
+	assert.Equal(t, DirectionBoth, DirectionAuto.Resolve(Key{Metric: "go_goroutines"}, Series{Family: gauge}))
+	assert.Equal(t, DirectionLowerIsWorse, DirectionLowerIsWorse.Resolve(Key{Metric: "sensor_event_duration"}, Series{}))
+}
+
+func TestRule_Evaluate_improvement(t *testing.T) {
+	rule := &Rule{Warn: 10, Error: 50, Direction: DirectionAuto}
+	k := Key{Metric: "sensor_event_duration"}
+
+	delta := rule.Evaluate(k, Series{Value: 100}, Series{Value: 40})
+	assert.False(t, delta.IsError, "a 60% latency improvement is not an error")
+	assert.True(t, delta.IsImprovement)
+
+	delta = rule.Evaluate(k, Series{Value: 100}, Series{Value: 160})
+	assert.True(t, delta.IsError)
+	assert.False(t, delta.IsImprovement)
+
+	delta = rule.Evaluate(Key{Metric: "go_goroutines"}, Series{Value: 100}, Series{Value: 40})
+	assert.True(t, delta.IsError, "both directions are regressions for other metrics")
+	assert.False(t, delta.IsImprovement)
+}
+
+func TestRule_Evaluate_guards(t *testing.T) {
+	rule := &Rule{Warn: 10, Error: 20, MinAbsDelta: 1, MinValue: 0.5, MinCount: 10, Direction: DirectionBoth}
+	k := Key{Metric: "sensor_event_duration", Labels: "Action=UPDATE_RESOURCE Type=Namespace"}
+	histogram := &prom2json.Family{Type: "HISTOGRAM"}
+
+	delta := rule.Evaluate(k, Series{Value: 3.04}, Series{Value: 3.80})
+	assert.InDelta(t, 25, delta.PercentChange, 0.1)
+	assert.False(t, delta.IsError, "absolute change is below min-abs-delta")
+
+	delta = rule.Evaluate(k, Series{Value: 0.1}, Series{Value: 5})
+	assert.False(t, delta.IsError, "baseline is below min-value")
+
+	delta = rule.Evaluate(k, Series{Value: 10}, Series{Value: 20})
+	assert.True(t, delta.IsError)
+
+	delta = rule.Evaluate(k, Series{Value: 3.04, Count: 1, Family: histogram}, Series{Value: 30.4, Count: 100, Family: histogram})
+	assert.True(t, delta.InsufficientData)
+	assert.False(t, delta.IsError)
+
+	delta = rule.Evaluate(k, Series{Value: 3.04, Count: 100, Family: histogram}, Series{Value: 30.4, Count: 100, Family: histogram})
+	assert.False(t, delta.InsufficientData)
+	assert.True(t, delta.IsError)
+}
@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/pkg/errors"
+	"golang.org/x/exp/maps"
+)
+
+// errWriter formats to w until the first error, which is kept in err.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...interface{}) {
+	if ew.err != nil {
+		return
+	}
+	_, ew.err = fmt.Fprintf(ew.w, format, args...)
+}
+
+// WriteOptions are the additional labels and the timestamp written along the series by some formats.
+type WriteOptions struct {
+	// Labels are added as columns in csv, to the report in json and as tags in influxdb.
+	Labels map[string]string
+	// Timestamp is the time of the series in seconds since the epoch for influxdb.
+	Timestamp int64
+	// InfluxDBFields writes each histogram and summary as a single influxdb line with sum, count, mean and one field
+	// per quantile instead of a line with a value field per series.
+	InfluxDBFields bool
+}
+
+// WriteSeries writes the series in the given format, one of plain, csv, json, jsonl or influxdb.
+func WriteSeries(w io.Writer, format string, m Map, opts WriteOptions) error {
+	keys := m.SortedKeys()
+
+	switch format {
+	case "plain":
+		return m.writePlain(w, keys)
+	case "csv":
+		return m.writeCSV(w, keys, opts.Labels)
+	case "json":
+		return m.writeJSON(w, keys, opts.Labels)
+	case "jsonl":
+		return m.writeJSONLines(w, keys)
+	case "influxdb":
+		return m.writeInfluxDBLineProtocol(w, keys, opts)
+	default:
+		return errors.Errorf("unknown output format %q", format)
+	}
+}
+
+func (m Map) writePlain(w io.Writer, keys []Key) error {
+	ew := &errWriter{w: w}
+	for _, k := range keys {
+		keyString := fmt.Sprintf("%s %s", k.Metric, k.Labels)
+		if m[k].Count == 0 {
+			ew.printf("%-80v %0.0f\n", keyString, m[k].Value)
+		} else {
+			fraction := fmt.Sprintf("(%0.0f/%d)", m[k].Sum, int64(m[k].Count))
+			ew.printf("%-80v %s %0.3f\n", keyString, fraction, m[k].Value)
+		}
+	}
+	return ew.err
+}
+
+func (m Map) writeCSV(w io.Writer, keys []Key, labels map[string]string) error {
+	cw := csv.NewWriter(w)
+	header := []string{"metric", "labels", "value"}
+	additionalHeaders := maps.Keys(labels)
+	slices.Sort(additionalHeaders)
+	header = append(header, additionalHeaders...)
+	additionalValues := make([]string, 0, len(additionalHeaders))
+	for _, h := range additionalHeaders {
+		additionalValues = append(additionalValues, labels[h])
+	}
+	if err := cw.Write(header); err != nil {
+		return errors.Wrap(err, "error writing header to csv")
+	}
+	for _, k := range keys {
+		value := fmt.Sprintf("%.8f", m[k].Value)
+		record := []string{k.Metric, k.Labels, value}
+		record = append(record, additionalValues...)
+		if err := cw.Write(record); err != nil {
+			return errors.Wrap(err, "error writing record to csv")
+		}
+	}
+	cw.Flush()
+	return errors.Wrap(cw.Error(), "error flushing to csv")
+}
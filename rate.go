@@ -0,0 +1,117 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/stackrox/prometheus-metric-parser/pkg/metrics"
+)
+
+func rateCommand() *cobra.Command {
+	var (
+		fromFile string
+		toFile   string
+		interval time.Duration
+
+		opts      *metricOptions
+		inputOpts *metrics.InputOptions
+	)
+
+	c := &cobra.Command{
+		Use:   "rate",
+		Short: "Rate takes two metrics files of the same process and outputs the per second rates of counters and the per interval means and quantiles of histograms",
+		RunE: func(c *cobra.Command, _ []string) error {
+			return rate(os.Stdout, fromFile, toFile, interval, inputOpts, opts)
+		},
+	}
+
+	c.Flags().StringVar(&fromFile, "from-file", "", "earlier metrics file to parse, - for stdin or an http(s) URL to scrape")
+	c.Flags().StringVar(&toFile, "to-file", "", "later metrics file to parse, - for stdin or an http(s) URL to scrape")
+	c.Flags().DurationVar(&interval, "interval", 0, "time between the two files e.g. 5m (defaults to the difference of the file modification times)")
+
+	opts = addMetricFlags(c)
+	addSinkFlags(c, opts)
+	inputOpts = addInputFlags(c)
+	return c
+}
+
+func rate(w io.Writer, fromFile, toFile string, interval time.Duration, inputOpts *metrics.InputOptions, opts *metricOptions) error {
+	if fromFile == "" {
+		return errors.New("from-file must be specified")
+	}
+	if toFile == "" {
+		return errors.New("to-file must be specified")
+	}
+	if fromFile == metrics.StdinPath && toFile == metrics.StdinPath {
+		return errors.New("only one of from-file and to-file can be read from stdin")
+	}
+	if opts.format == "influxdb" && opts.timestamp == 0 {
+		return errors.New("a --timestamp must be specified for influxdb ingest")
+	}
+	if interval == 0 {
+		var err error
+		if interval, err = modTimeInterval(fromFile, toFile); err != nil {
+			return err
+		}
+	}
+	seriesOpts, err := opts.seriesOptions()
+	if err != nil {
+		return err
+	}
+	// Quantiles and the minimum histogram count apply to the interval, not to the snapshots.
+	snapshotOpts := metrics.Options{TrimPrefix: seriesOpts.TrimPrefix}
+	if seriesOpts.Aggregate != nil {
+		// Series are aggregated per snapshot, so the selectors have to apply before, except for the quantile matchers,
+		// as the quantiles are only calculated for the interval.
+		before, after, err := seriesOpts.Aggregate.SplitSelectors(seriesOpts)
+		if err != nil {
+			return err
+		}
+		snapshotOpts.Aggregate = seriesOpts.Aggregate
+		snapshotOpts.Select, snapshotOpts.Exclude = before.Select, before.Exclude
+		seriesOpts.Select, seriesOpts.Exclude = after.Select, after.Exclude
+	}
+
+	var snapshots []metrics.Map
+	for _, file := range []string{fromFile, toFile} {
+		families, err := readFile(file, inputOpts)
+		if err != nil {
+			return errors.Wrapf(err, "error reading %s", file)
+		}
+		snapshot, err := metrics.ToSeries(opts.filter(families), snapshotOpts)
+		if err != nil {
+			return errors.Wrapf(err, "error generating metric map of %s", file)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	rates, err := metrics.Rates(snapshots[0], snapshots[1], interval, seriesOpts)
+	if err != nil {
+		return err
+	}
+	return opts.writeSeries(w, rates)
+}
+
+// modTimeInterval returns the difference of the modification times of two local files.
+func modTimeInterval(fromFile, toFile string) (time.Duration, error) {
+	var modTimes []time.Time
+	for _, file := range []string{fromFile, toFile} {
+		if file == metrics.StdinPath || strings.Contains(file, "://") {
+			return 0, errors.New("an --interval must be specified for stdin and URLs")
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return 0, err
+		}
+		modTimes = append(modTimes, info.ModTime())
+	}
+	interval := modTimes[1].Sub(modTimes[0])
+	if interval <= 0 {
+		return 0, errors.Errorf("%s is not modified after %s, specify the --interval", toFile, fromFile)
+	}
+	return interval, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stackrox/prometheus-metric-parser/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_rate_aggregateQuantileSelector(t *testing.T) {
+	dir := t.TempDir()
+	fromFile, toFile := filepath.Join(dir, "from"), filepath.Join(dir, "to")
+	require.NoError(t, os.WriteFile(fromFile, []byte(`# TYPE h histogram
+h_bucket{Op="Get",le="1"} 10
+h_bucket{Op="Get",le="2"} 10
+h_bucket{Op="Get",le="+Inf"} 10
+h_sum{Op="Get"} 10
+h_count{Op="Get"} 10
+`), 0o644))
+	require.NoError(t, os.WriteFile(toFile, []byte(`# TYPE h histogram
+h_bucket{Op="Get",le="1"} 10
+h_bucket{Op="Get",le="2"} 20
+h_bucket{Op="Get",le="+Inf"} 20
+h_sum{Op="Get"} 25
+h_count{Op="Get"} 20
+`), 0o644))
+
+	for _, aggregate := range []string{"", "sum"} {
+		t.Run("aggregate="+aggregate, func(t *testing.T) {
+			var buff bytes.Buffer
+			err := rate(&buff, fromFile, toFile, time.Minute, &metrics.InputOptions{}, &metricOptions{
+				format:    "plain",
+				quantiles: "0.5",
+				selectors: []string{`h{quantile="0.5"}`},
+				aggregate: aggregate,
+			})
+			require.NoError(t, err)
+			lines := strings.Split(strings.TrimSpace(buff.String()), "\n")
+			require.Len(t, lines, 1, "only the selected quantile is printed")
+			assert.Contains(t, lines[0], "quantile=0.5")
+			assert.True(t, strings.HasSuffix(lines[0], " 1.500"), lines[0])
+		})
+	}
+}
@@ -1,34 +1,45 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
 	"log"
+	"os"
 
 	"github.com/spf13/cobra"
+	"github.com/stackrox/prometheus-metric-parser/pkg/gcp"
+	"github.com/stackrox/prometheus-metric-parser/pkg/metrics"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
 )
 
 func singleCommand() *cobra.Command {
 	var (
 		file string
 
-		opts *metricOptions
+		opts      *metricOptions
+		inputOpts *metrics.InputOptions
 	)
 
 	c := &cobra.Command{
 		Use:   "single",
 		Short: "Single takes all the metrics and outputs them as key value pairs. It will average histograms",
 		RunE: func(c *cobra.Command, _ []string) error {
-			return single(file, opts)
+			return single(os.Stdout, file, inputOpts, opts)
 		},
 	}
 
-	c.Flags().StringVar(&file, "file", "", "file to parse")
+	c.Flags().StringVar(&file, "file", "", "file to parse, - for stdin or an http(s) URL to scrape")
 
 	opts = addMetricFlags(c)
+	addSinkFlags(c, opts)
+	addGCPFlags(c, opts)
+	inputOpts = addInputFlags(c)
 	return c
 }
 
-func single(file string, opts *metricOptions) error {
+func single(w io.Writer, file string, inputOpts *metrics.InputOptions, opts *metricOptions) error {
 	if file == "" {
 		return errors.New("file must be specified")
 	}
@@ -38,23 +49,85 @@ func single(file string, opts *metricOptions) error {
 	if (opts.format == "gcp-monitoring" || opts.format == "influxdb") && opts.timestamp == 0 {
 		return errors.New("a --timestamp must be specified for gcp-monitoring/influxdb ingest")
 	}
-	families, err := readFile(file)
+	families, err := readFile(file, inputOpts)
 	if err != nil {
 		return err
 	}
+	metricMap, err := opts.toSeries(families)
+	if err != nil {
+		return err
+	}
+
 	if opts.format == "gcp-monitoring" {
-		gcpMonitoring, err := gcpMonitoringConnect(opts.projectID)
-		defer gcpMonitoring.close()
+		valueType, err := parseGCPValueType(opts.gcpValueType)
+		if err != nil {
+			return err
+		}
+		startTime := opts.gcpStartTime
+		if startTime == 0 {
+			startTime, _ = gcp.ProcessStartTime(families)
+		}
+		client, err := gcpClient(w, opts)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := client.Close(); err != nil {
+				log.Printf("Error closing GCP monitoring client: %+v", err)
+			}
+		}()
+		client.BatchSize = opts.gcpBatchSize
+		client.Distributions = opts.gcpDistributions
+		client.ValueType = valueType
+		client.StartTime = startTime
+		client.Migrate = opts.gcpMigrate
+		client.Labels = labelsFromOpts(opts.labels)
+		config, err := loadGCPConfig(opts.gcpConfig, opts.gcpMetricPrefix, opts.gcpResourceType, opts.gcpResourceLabels)
+		if err != nil {
+			return err
+		}
+		if err := config.Apply(client); err != nil {
+			return err
+		}
+		if err := client.CreateMetricDescriptors(families, metricMap, opts.quantiles != ""); err != nil {
+			return err
+		}
+		return client.WriteSeries(metricMap, opts.timestamp)
+	}
+	return opts.writeSeries(w, metricMap)
+}
+
+// gcpClient connects to GCP monitoring, or creates a dry run client printing the requests to w or writing them to
+// the dry run directory.
+func gcpClient(w io.Writer, opts *metricOptions) (*gcp.Client, error) {
+	if opts.dryRun || opts.dryRunDir != "" {
+		client, err := gcp.DryRun(opts.projectID, w, opts.dryRunDir)
 		if err != nil {
-			log.Fatalf("Cannot connect to GCP monitoring: %v\n", err)
+			return nil, err
+		}
+		if opts.dryRunDir != "" {
+			client.Progress = w
 		}
-		gcpMonitoring.createMetricDescriptors(families)
+		return client, nil
 	}
-	metricMap, err := familiesToKeyPairs(families, opts)
+	client, err := gcp.Connect(context.Background(), opts.projectID)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	metricMap.Print(opts.format, labelsFromOpts(opts.labels), opts.projectID, opts.timestamp)
+	client.Progress = w
+	client.Workers = opts.gcpWorkers
+	return client, nil
+}
 
-	return nil
+func parseGCPValueType(valueType string) (metricpb.MetricDescriptor_ValueType, error) {
+	switch valueType {
+	case "auto":
+		return metricpb.MetricDescriptor_VALUE_TYPE_UNSPECIFIED, nil
+	case "int64":
+		return metricpb.MetricDescriptor_INT64, nil
+	case "double":
+		return metricpb.MetricDescriptor_DOUBLE, nil
+	default:
+		return 0, fmt.Errorf("unknown GCP value type %q (expected auto, int64 or double)", valueType)
+	}
 }
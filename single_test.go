@@ -3,8 +3,11 @@ package main
 import (
 	"bytes"
 	_ "embed"
-	"github.com/stretchr/testify/assert"
 	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stackrox/prometheus-metric-parser/pkg/metrics"
+	"github.com/stretchr/testify/assert"
 )
 
 //go:embed "testdata/plain.txt"
@@ -13,6 +16,9 @@ var plainOutput string
 //go:embed "testdata/metrics.csv"
 var csvOutput string
 
+//go:embed "testdata/influxdb.txt"
+var influxDBOutput string
+
 func Test_single(t *testing.T) {
 
 	for _, tt := range []struct {
@@ -21,16 +27,17 @@ func Test_single(t *testing.T) {
 	}{
 		{format: "plain", expected: plainOutput},
 		{format: "csv", expected: csvOutput},
+		{format: "influxdb", expected: influxDBOutput},
 	} {
 		t.Run(tt.format, func(t *testing.T) {
 			var buff bytes.Buffer
-			out = &buff
 
-			err := single("testdata/metrics-1", &metricOptions{
+			err := single(&buff, "testdata/metrics-1", &metrics.InputOptions{}, &metricOptions{
 				minHistogramCount: 5,
 				trimPrefix:        "rox_central_",
 				format:            tt.format,
 				labels:            "B=b,A=a , C= c ,,D=,=,=xyz",
+				timestamp:         1713462000,
 			})
 
 			assert.NoError(t, err)
@@ -39,3 +46,42 @@ func Test_single(t *testing.T) {
 	}
 
 }
+
+func Test_singleCommand_credentialsNotInHelp(t *testing.T) {
+	t.Setenv("INFLUXDB_TOKEN", "secret-token")
+	t.Setenv("INFLUXDB_PASSWORD", "secret-password")
+
+	var buff bytes.Buffer
+	c := singleCommand()
+	c.SetOut(&buff)
+	assert.NoError(t, c.Usage())
+	assert.Contains(t, buff.String(), "--influxdb-token")
+	assert.NotContains(t, buff.String(), "secret-token")
+	assert.NotContains(t, buff.String(), "secret-password")
+}
+
+func Test_sinkFlags(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		command  func() *cobra.Command
+		influxDB bool
+		gcp      bool
+	}{
+		{name: "single", command: singleCommand, influxDB: true, gcp: true},
+		{name: "rate", command: rateCommand, influxDB: true},
+		{name: "compare", command: compareCommand},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.command()
+			assert.Equal(t, tt.influxDB, c.Flags().Lookup("influxdb-url") != nil)
+			assert.Equal(t, tt.gcp, c.Flags().Lookup("gcp-config") != nil)
+			for _, name := range []string{"labels", "project-id", "timestamp"} {
+				assert.NotNil(t, c.Flags().Lookup(name), "%s is still accepted", name)
+			}
+		})
+	}
+
+	c := compareCommand()
+	assert.NoError(t, c.ParseFlags([]string{"--labels", "Test=ci", "--project-id", "stackrox-ci", "--timestamp", "1713462000"}))
+	assert.True(t, c.Flags().Lookup("labels").Hidden, "ingest flags are deprecated on compare")
+}